@@ -7,7 +7,7 @@ import (
 	"go/token"
 	"go/types"
 	"maps"
-	"strconv"
+	"slices"
 	"strings"
 	"text/template/parse"
 )
@@ -56,8 +56,54 @@ const (
 	// ErrorTypeMapKey reports a map index whose key cannot match the map's
 	// key type.
 	ErrorTypeMapKey
+	// ErrorTypeLoopControl reports a {{break}} or {{continue}} outside a
+	// {{range}} body, including one in a template invoked from a loop.
+	ErrorTypeLoopControl
+	// ErrorTypeAssignment reports a {{$x = value}} whose value is not
+	// assignable to the variable under AssignmentStrict.
+	ErrorTypeAssignment
+	// ErrorTypeVariableJoin reports a field chain on a variable that fails
+	// for one of the types the variable may hold after branches that
+	// assign it join again.
+	ErrorTypeVariableJoin
+	// ErrorTypeNilPointer reports a field access through a pointer or
+	// interface value that is not guarded against nil. It is only reported
+	// when Global.NilPointers is set.
+	ErrorTypeNilPointer
+	// ErrorTypeDeprecated reports a field or method whose doc comment has a
+	// "Deprecated: " paragraph. It is reported with SeverityWarning and only
+	// when Global.Deprecations is set.
+	ErrorTypeDeprecated
+	// ErrorTypeUnusedSuppression reports a check:ignore directive, or one
+	// of the error types it names, that suppressed no error. Package
+	// reports it with SeverityWarning.
+	ErrorTypeUnusedSuppression
+	// ErrorTypeTemplateRedefined reports a template definition that
+	// silently replaces an earlier one of the same name: a {{define}} in a
+	// later file, or a ParseFS file sharing its base name with one from
+	// another directory. Replacing a {{block}} is not reported.
+	ErrorTypeTemplateRedefined
 )
 
+// Severity ranks a *Error. The zero value is SeverityError.
+type Severity int
+
+const (
+	// SeverityError marks a failure the template would hit at runtime.
+	SeverityError Severity = iota
+	// SeverityWarning marks advisory findings, such as use of a
+	// deprecated field, that do not fail at runtime.
+	SeverityWarning
+)
+
+// String returns "error" or "warning".
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
 // String returns a stable slug for the error type, suitable for use as a
 // diagnostic code.
 func (t ErrorType) String() string {
@@ -92,6 +138,20 @@ func (t ErrorType) String() string {
 		return "identifier-chain"
 	case ErrorTypeMapKey:
 		return "map-key"
+	case ErrorTypeLoopControl:
+		return "loop-control"
+	case ErrorTypeAssignment:
+		return "assignment"
+	case ErrorTypeVariableJoin:
+		return "variable-join"
+	case ErrorTypeNilPointer:
+		return "nil-pointer"
+	case ErrorTypeDeprecated:
+		return "deprecated"
+	case ErrorTypeUnusedSuppression:
+		return "unused-suppression"
+	case ErrorTypeTemplateRedefined:
+		return "template-redefined"
 	default:
 		return "unknown"
 	}
@@ -101,9 +161,22 @@ type Error struct {
 	// Type classifies the failure.
 	Type ErrorType
 
+	// Severity is SeverityError unless the failure is advisory: a warning
+	// does not mean the template fails at runtime.
+	Severity Severity
+
 	Tree *parse.Tree
 	Node parse.Node
 
+	// Start and End locate the offending text in the template source, End
+	// being exclusive: the identifier that failed to resolve where there
+	// is one, otherwise Node. Execute sets them on every error it returns
+	// that has a Tree and Node, with a line and column when Global.Sources
+	// holds the tree's text. Columns count bytes from 1, as in go/token.
+	// For templates parsed from a Go string literal, Package moves them
+	// into the Go file, and the message reports that position.
+	Start, End token.Position
+
 	// X is the type most relevant to the failure: the receiver for field or
 	// method lookups, the pipeline result for range, the signature for call
 	// errors. It is nil when no type is relevant.
@@ -115,6 +188,16 @@ type Error struct {
 	// declaration position is known.
 	Decl token.Position
 
+	// Suggestions lists names close to the field, method, function, or
+	// template the failure could not resolve, closest first, for "did you
+	// mean" hints. It is nil when nothing is close.
+	Suggestions []string
+
+	// Fixes holds edits to the template source that resolve the failure,
+	// such as correcting the case of a field name. It is nil when no fix
+	// is known.
+	Fixes []TextEdit
+
 	// Secondary marks a follow-on failure whose root cause is another error
 	// in the same tree: a variable lookup that failed only because the
 	// pipeline declaring that variable already failed. Diagnostic tools may
@@ -123,6 +206,14 @@ type Error struct {
 
 	err error
 
+	// span narrows Start and End to part of Node, such as one identifier
+	// of a field chain.
+	span span
+
+	// inLiteral reports that Start and End were moved from the template
+	// into the Go string literal it was parsed from.
+	inLiteral bool
+
 	// render re-renders the cause message with a caller-chosen type
 	// formatter. It is set when the message embeds type names; nil means
 	// the message has no types to re-render.
@@ -173,6 +264,12 @@ func wrapError(errType ErrorType, tree *parse.Tree, node parse.Node, err error)
 		located := *e
 		if located.Tree == nil {
 			located.Tree = tree
+			located.Fixes = slices.Clone(e.Fixes)
+			for i := range located.Fixes {
+				if located.Fixes[i].Filename == "" && tree != nil {
+					located.Fixes[i].Filename = tree.ParseName
+				}
+			}
 		}
 		if located.Node == nil {
 			located.Node = node
@@ -222,12 +319,30 @@ func fullTypeFormat(q types.Qualifier) typeFormatFunc {
 // line renders the single-line message for a leaf error, rendering type
 // names with tf.
 func (e *Error) line(tf typeFormatFunc) string {
-	message := e.messageWith(tf)
-	if e.Tree == nil || e.Node == nil {
-		return message
+	return e.prefix() + e.messageWith(tf)
+}
+
+// prefix renders the location part of a leaf error's message, marking
+// warnings after the jump-to-source position. An error with no tree, such
+// as an unused Go check:ignore comment, is located by Start alone.
+func (e *Error) prefix() string {
+	if e.Tree == nil || isNilNode(e.Node) {
+		if !e.Start.IsValid() {
+			return ""
+		}
+		if e.Severity == SeverityWarning {
+			return e.Start.String() + ": warning: "
+		}
+		return e.Start.String() + ": "
 	}
 	loc, ctx := e.Tree.ErrorContext(e.Node)
-	return fmt.Sprintf("%s: executing %q at <%s>: %s", loc, e.Tree.Name, ctx, message)
+	if e.inLiteral {
+		loc = e.Start.String()
+	}
+	if e.Severity == SeverityWarning {
+		loc += ": warning"
+	}
+	return fmt.Sprintf("%s: executing %q at <%s>: ", loc, e.Tree.Name, ctx)
 }
 
 // messageWith renders the cause message through tf when the error (or its
@@ -346,11 +461,7 @@ func (e *Error) VerboseError() string {
 		}
 		return strings.Join(blocks, "\n\n")
 	}
-	var prefix string
-	if e.Tree != nil && e.Node != nil {
-		loc, ctx := e.Tree.ErrorContext(e.Node)
-		prefix = fmt.Sprintf("%s: executing %q at <%s>: ", loc, e.Tree.Name, ctx)
-	}
+	prefix := e.prefix()
 	v, ok := errors.AsType[VerboseErrorer](e.err)
 	if !ok {
 		return prefix + e.err.Error()
@@ -375,16 +486,106 @@ type Global struct {
 	InspectTemplateNode TemplateNodeInspectorFunc
 	InspectCallNode     ExecuteTemplateNodeInspectorFunc
 
+	// TypeGuards maps template function names to the concrete type their
+	// operand holds when the function succeeds. It lets templates that
+	// receive interface-typed data (any, map[string]any) narrow it before
+	// selecting fields:
+	//
+	//	{{if isUser .}}{{.Name}}{{end}}
+	//	{{with asUser .Author}}{{.Name}}{{end}}
+	//
+	// An {{if}} whose pipeline calls a guard on dot or on a variable checks
+	// its body with that operand narrowed to the guard type. A {{with}}
+	// whose pipeline calls a guard returning a value that can hold the
+	// guard type, such as any, checks its body, and any variable the
+	// pipeline declares, with the guard type as dot; a predicate returning
+	// bool leaves dot a bool there, as it is at runtime. Else branches keep
+	// the unnarrowed types. Guards must still be present in the CallChecker so
+	// the call itself type-checks.
+	TypeGuards map[string]types.Type
+
+	// Lenient permits field, method, and map key selection through
+	// interface-typed values such as the elements of a map[string]any,
+	// where the concrete type is only known at runtime. Each such access
+	// is reported to InspectUncheckedNode instead of failing, and the
+	// selected value is typed as any so the rest of the chain is unchecked
+	// too. Ranging over an interface-typed value is permitted the same way.
+	Lenient bool
+
+	// InspectUncheckedNode, when set, is called for each node that Lenient
+	// let through without checking. tp is the interface type the node was
+	// evaluated on.
+	InspectUncheckedNode UncheckedNodeInspectorFunc
+
+	// NilPointers enables a lint for field accesses that fail at runtime
+	// with "nil pointer evaluating" when a value on the path is nil: a
+	// field selected through a pointer, or anything selected through an
+	// interface value, is reported with ErrorTypeNilPointer unless an
+	// enclosing {{with}} or {{if}} tests the same path first:
+	//
+	//	{{with .User.Profile}}{{.Name}}{{end}}
+	//	{{if .User.Profile}}{{.User.Profile.Name}}{{end}}
+	//	{{if and .User .User.Profile}}...{{end}}
+	//
+	// Dot, $ and range and with variables are assumed to be non-nil. A
+	// {{/* check:nonnil .User.Profile */}} comment asserts that the listed
+	// paths are non-nil for the rest of the enclosing block; trees must be
+	// parsed with parse.ParseComments for the comment to be seen.
+	NilPointers bool
+
+	// Deprecations reports each field or method whose doc comment has a
+	// "Deprecated: " paragraph as an ErrorTypeDeprecated warning, the way
+	// staticcheck flags deprecated identifiers in Go code. Doc comments are
+	// read from the declaring source files.
+	Deprecations bool
+
+	// Overlay holds the contents of files that replace, or are missing
+	// from, the disk, keyed by absolute path as in packages.Config.Overlay.
+	// Source files read for doc comments are read through it.
+	Overlay map[string][]byte
+
+	// Assignment selects how {{$x = value}} is checked when value's type
+	// differs from the type $x holds. The zero value is AssignmentWiden.
+	Assignment AssignmentPolicy
+
 	// Qualifier controls how types are printed by TypeString and by the
 	// legacy VerboseError/FormatVerbose rendering only. Error messages
 	// always print full package paths (nil qualifier), and DetailedError
 	// takes its own types.Qualifier parameter — prefer that for qualified
 	// rendering. See types.WriteType for qualifier semantics.
 	Qualifier types.Qualifier
+
+	// Sources maps trees to the text they were parsed from, which Error
+	// positions are computed from. PackageConfig.Check sets it; callers of
+	// Execute set it to get a line and column in Error.Start and End, which
+	// have only an offset for a tree without an entry.
+	Sources map[*parse.Tree]string
+
+	docs *docComments
 }
 
+// AssignmentPolicy selects how Execute treats {{$x = value}} when value's
+// type differs from the variable's type. text/template itself accepts any
+// reassignment.
+type AssignmentPolicy int
+
+const (
+	// AssignmentWiden accepts every assignment. After {{$x = value}} the
+	// variable holds value's type; where branches that leave it holding
+	// different types join again, it holds the wider type when one is
+	// assignable to the other, and otherwise any, with later field
+	// accesses checked against each of the joined types.
+	AssignmentWiden AssignmentPolicy = iota
+	// AssignmentStrict reports ErrorTypeAssignment when value is not
+	// assignable to the type the variable was declared with, and leaves
+	// the variable unchanged.
+	AssignmentStrict
+)
+
 type TemplateNodeInspectorFunc func(node *parse.TemplateNode, t *parse.Tree, tp types.Type)
 
+type UncheckedNodeInspectorFunc func(node parse.Node, t *parse.Tree, tp types.Type)
+
 func NewGlobal(pkg *types.Package, fileSet *token.FileSet, trees TreeFinder, fnChecker CallChecker) *Global {
 	return &Global{
 		trees:           trees,
@@ -440,37 +641,228 @@ type TypeNodeMapping map[types.Type][]parse.Node
 // the returned error is a *Error: a single leaf for one failure, or an
 // ErrorTypeAggregate node grouping every independent failure found. Walk the
 // full tree with Error.All or Unwrap; each leaf carries the ErrorType
-// classification, the parse.Tree and parse.Node it was found at, and, when
-// relevant, the types.Type being checked.
+// classification, the parse.Tree and parse.Node it was found at, the Start
+// and End of the offending source text, and, when relevant, the types.Type
+// being checked.
 func Execute(global *Global, tree *parse.Tree, data types.Type) error {
-	s := &scope{
-		global: global,
-		variables: map[string]types.Type{
-			"$": data,
-		},
-	}
+	s := &scope{global: global, reports: new([]error)}
+	s.declare("$", data)
 	_, err := s.walk(tree, data, nil, tree.Root)
+	err = joinErrors(tree, tree.Root, append([]error{err}, *s.reports...)...)
+	if checkErr, ok := err.(*Error); ok {
+		for e := range checkErr.All {
+			e.locate(global.Sources)
+		}
+	}
 	return err
 }
 
+// variable is an entry in text/template's variable stack. A child scope
+// copies its parent's stack, so a declaration in a nested body is dropped
+// with that body's scope at {{end}}, while {{$x = value}} changes only the
+// copy the branch sees. Where branches meet again, the copies are joined
+// back into the parent.
+type variable struct {
+	name string
+
+	// declared is the type the variable was declared with. It is what
+	// AssignmentStrict checks assignments against.
+	declared types.Type
+
+	// tp is the type the variable holds at this point of the walk.
+	tp types.Type
+
+	// joined lists the types the variable may hold after branches that
+	// left it holding incompatible types met again. tp is then any and
+	// field accesses are checked against each joined type.
+	joined []types.Type
+}
+
+// loopState collects the variable stacks a {{range}} body leaves through
+// {{break}} and {{continue}}, so they can be joined into the loop exit and
+// back-edge.
+type loopState struct {
+	breaks, continues [][]variable
+}
+
 type scope struct {
 	global    *Global
-	variables map[string]types.Type
+	variables []variable
 
 	// failed records variables whose declaration pipeline failed to check,
 	// so later lookups can be marked Secondary instead of reported as
 	// independent failures.
 	failed map[string]bool
+
+	// loopDepth counts the {{range}} bodies enclosing the walk in the
+	// current tree; invokedInLoop records that the tree was reached
+	// through a {{template}} action inside one. loop is the innermost of
+	// those bodies.
+	loopDepth     int
+	invokedInLoop bool
+	loop          *loopState
+
+	// probing marks a walk that only computes the types a {{range}} body
+	// assigns to its variables. Inspectors are not called, invoked
+	// templates are not walked and nothing is reported while probing.
+	probing bool
+
+	// nonNil holds the field paths, such as .User.Profile or $u.Profile,
+	// that an enclosing {{with}}, {{if}} or check:nonnil comment guards
+	// against nil. See Global.NilPointers.
+	nonNil map[string]bool
+
+	// reports collects findings that do not stop the walk, such as the
+	// nil pointer lint. Execute returns them with the walk's errors.
+	reports *[]error
 }
 
 func (s *scope) child() *scope {
 	return &scope{
-		global:    s.global,
-		variables: maps.Clone(s.variables),
-		failed:    maps.Clone(s.failed),
+		global:        s.global,
+		variables:     slices.Clone(s.variables),
+		failed:        maps.Clone(s.failed),
+		loopDepth:     s.loopDepth,
+		invokedInLoop: s.invokedInLoop,
+		loop:          s.loop,
+		probing:       s.probing,
+		nonNil:        maps.Clone(s.nonNil),
+		reports:       s.reports,
+	}
+}
+
+// report records a finding that does not stop the walk.
+func (s *scope) report(err error) {
+	if s.probing || s.reports == nil {
+		return
+	}
+	*s.reports = append(*s.reports, err)
+}
+
+// find returns the index of the innermost variable with the given name.
+func (s *scope) find(name string) (int, bool) {
+	for i := len(s.variables) - 1; i >= 0; i-- {
+		if s.variables[i].name == name {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// lookup returns the type the named variable holds.
+func (s *scope) lookup(name string) (variable, bool) {
+	i, ok := s.find(name)
+	if !ok {
+		return variable{}, false
+	}
+	return s.variables[i], true
+}
+
+// declare pushes a new variable, shadowing any outer one with the same name
+// until this scope ends.
+func (s *scope) declare(name string, tp types.Type) {
+	s.forgetNonNil(name)
+	s.variables = append(s.variables, variable{name: name, declared: tp, tp: tp})
+}
+
+// narrow sets the type an existing variable holds in this scope only, as a
+// type guard does for the body it guards.
+func (s *scope) narrow(name string, tp types.Type) {
+	if i, ok := s.find(name); ok {
+		s.variables[i].tp = tp
+		s.variables[i].joined = nil
 	}
 }
 
+// assign sets an existing variable the way text/template's setVar does.
+// From here on the variable holds tp; under AssignmentStrict, tp must be
+// assignable to the type the variable was declared with.
+func (s *scope) assign(tree *parse.Tree, n *parse.VariableNode, tp types.Type) error {
+	name := n.Ident[0]
+	i, ok := s.find(name)
+	if !ok {
+		e := newError(ErrorTypeVariableNotFound, tree, n, "undefined variable: %s", name)
+		e.Secondary = s.failed[name]
+		return e
+	}
+	v := &s.variables[i]
+	if s.global.Assignment == AssignmentStrict && !assignableVariable(tp, v.declared) {
+		return newError(ErrorTypeAssignment, tree, n, "can't assign %s to %s of type %s", tp, name, v.declared).withX(v.declared)
+	}
+	v.tp = tp
+	v.joined = nil
+	s.forgetNonNil(name)
+	return nil
+}
+
+// join sets each variable of s to hold any type it holds at the end of the
+// given branches. Each branch's stack starts with the variables of s.
+func (s *scope) join(branches ...[]variable) {
+	for i := range s.variables {
+		v := branches[0][i]
+		for _, branch := range branches[1:] {
+			v = joinVariable(v, branch[i])
+		}
+		s.variables[i] = v
+	}
+}
+
+// joinVariable returns v holding any type a or b may hold.
+func joinVariable(a, b variable) variable {
+	alternatives := slices.Clone(a.alternatives())
+	for _, tp := range b.alternatives() {
+		if !slices.ContainsFunc(alternatives, func(x types.Type) bool { return types.Identical(x, tp) }) {
+			alternatives = append(alternatives, tp)
+		}
+	}
+	a.tp, a.joined = joinTypes(alternatives)
+	return a
+}
+
+// alternatives returns the types the variable may hold.
+func (v variable) alternatives() []types.Type {
+	if v.joined != nil {
+		return v.joined
+	}
+	return []types.Type{v.tp}
+}
+
+// joinTypes returns a type holding values of every type in alternatives:
+// the widest of them when each is assignable to it, and otherwise any
+// together with the alternatives themselves.
+func joinTypes(alternatives []types.Type) (types.Type, []types.Type) {
+	if len(alternatives) == 1 {
+		return alternatives[0], nil
+	}
+	// At runtime a variable holds a constant's default type.
+	wide := types.Default(alternatives[0])
+	for _, tp := range alternatives[1:] {
+		if tp = types.Default(tp); assignableVariable(wide, tp) {
+			wide = tp
+		}
+	}
+	for _, tp := range alternatives {
+		if !assignableVariable(tp, wide) {
+			return types.Universe.Lookup("any").Type(), alternatives
+		}
+	}
+	return wide, nil
+}
+
+// sameVariables reports whether a and b hold the same types.
+func sameVariables(a, b []variable) bool {
+	return slices.EqualFunc(a, b, func(x, y variable) bool {
+		return types.Identical(x.tp, y.tp) && slices.EqualFunc(x.joined, y.joined, types.Identical)
+	})
+}
+
+// assignableVariable reports whether a value of type tp can be stored in a
+// variable of type vt without changing vt. A variable declared from a
+// constant holds the constant's default type at runtime.
+func assignableVariable(tp, vt types.Type) bool {
+	return types.AssignableTo(tp, vt) || types.AssignableTo(tp, types.Default(vt))
+}
+
 // markFailedDecls records the variables a failing pipeline would have
 // declared.
 func (s *scope) markFailedDecls(n *parse.PipeNode) {
@@ -496,7 +888,7 @@ func (s *scope) walk(tree *parse.Tree, dot, prev types.Type, node parse.Node) (t
 	case *parse.CommandNode:
 		return s.checkCommandNode(tree, dot, prev, n)
 	case *parse.FieldNode:
-		return s.checkFieldNode(tree, dot, n, nil)
+		return s.checkFieldNode(tree, dot, n, nil, nil)
 	case *parse.PipeNode:
 		return s.checkPipeNode(tree, dot, n)
 	case *parse.IfNode:
@@ -512,7 +904,7 @@ func (s *scope) walk(tree *parse.Tree, dot, prev types.Type, node parse.Node) (t
 	case *parse.NumberNode:
 		return newNumberNodeType(tree, n)
 	case *parse.VariableNode:
-		return s.checkVariableNode(tree, n, nil)
+		return s.checkVariableNode(tree, n, nil, nil)
 	case *parse.IdentifierNode:
 		return s.checkIdentifierNode(tree, n)
 	case *parse.TextNode:
@@ -520,38 +912,96 @@ func (s *scope) walk(tree *parse.Tree, dot, prev types.Type, node parse.Node) (t
 	case *parse.WithNode:
 		return nil, s.checkWithNode(tree, dot, n)
 	case *parse.CommentNode:
+		s.checkCommentNode(n)
 		return nil, nil
 	case *parse.NilNode:
 		return types.Typ[types.UntypedNil], nil
 	case *parse.ChainNode:
-		return s.checkChainNode(tree, dot, prev, n, nil)
+		return s.checkChainNode(tree, dot, prev, n, nil, nil)
 	case *parse.BranchNode:
 		return nil, nil
 	case *parse.BreakNode:
-		return nil, nil
+		return nil, s.checkLoopControl(tree, n, "break")
 	case *parse.ContinueNode:
-		return nil, nil
+		return nil, s.checkLoopControl(tree, n, "continue")
 	default:
 		return nil, newError(ErrorTypeUnexpectedNode, tree, n, "missing node type check %T", n)
 	}
 }
 
-func (s *scope) checkChainNode(tree *parse.Tree, dot, prev types.Type, n *parse.ChainNode, args []types.Type) (types.Type, error) {
+// checkLoopControl reports a {{break}} or {{continue}} that is not inside a
+// {{range}} body of its own tree. The parser rejects most of these, but
+// trees added with AddParseTree or built by other tools can contain them.
+// In a template invoked from a loop, text/template exits or continues the
+// caller's loop; outside any loop, execution panics.
+func (s *scope) checkLoopControl(tree *parse.Tree, n parse.Node, keyword string) error {
+	switch {
+	case s.loopDepth > 0:
+		// The loop continues or exits with the variables as they are here.
+		if keyword == "break" {
+			s.loop.breaks = append(s.loop.breaks, slices.Clone(s.variables))
+		} else {
+			s.loop.continues = append(s.loop.continues, slices.Clone(s.variables))
+		}
+		return nil
+	case s.invokedInLoop:
+		return newError(ErrorTypeLoopControl, tree, n, "{{%s}} in template %q affects the {{range}} that invoked it", keyword, tree.Name)
+	default:
+		return newError(ErrorTypeLoopControl, tree, n, "{{%s}} outside {{range}}", keyword)
+	}
+}
+
+func (s *scope) checkChainNode(tree *parse.Tree, dot, prev types.Type, n *parse.ChainNode, argNodes []parse.Node, args []types.Type) (types.Type, error) {
 	x, err := s.walk(tree, dot, prev, n.Node)
 	if err != nil {
 		return nil, err
 	}
-	return s.checkIdentifiers(tree, x, n, n.Field, args)
+	return s.checkIdentifiers(tree, x, n, n.Field, argNodes, args)
 }
 
-func (s *scope) checkVariableNode(tree *parse.Tree, n *parse.VariableNode, args []types.Type) (types.Type, error) {
-	tp, ok := s.variables[n.Ident[0]]
+func (s *scope) checkVariableNode(tree *parse.Tree, n *parse.VariableNode, argNodes []parse.Node, args []types.Type) (types.Type, error) {
+	v, ok := s.lookup(n.Ident[0])
 	if !ok {
 		e := newError(ErrorTypeVariableNotFound, tree, n, "variable %s not found", n.Ident[0])
 		e.Secondary = s.failed[n.Ident[0]]
 		return nil, e
 	}
-	return s.checkIdentifiers(tree, tp, n, n.Ident[1:], args)
+	if v.joined == nil || len(n.Ident) == 1 {
+		return s.checkIdentifiers(tree, v.tp, n, n.Ident[1:], argNodes, args)
+	}
+	// After a join the variable may hold any of the joined types, so the
+	// chain must be valid on each of them.
+	results := make([]types.Type, 0, len(v.joined))
+	for _, tp := range v.joined {
+		result, err := s.checkIdentifiers(tree, tp, n, n.Ident[1:], argNodes, args)
+		if err != nil {
+			return nil, joinedVariableError(tree, n, v, tp, err)
+		}
+		results = append(results, result)
+	}
+	tp, _ := joinTypes(results)
+	return tp, nil
+}
+
+// joinedVariableError reports a field chain that fails on tp, one of the
+// types v may hold after a join.
+func joinedVariableError(tree *parse.Tree, n *parse.VariableNode, v variable, tp types.Type, err error) *Error {
+	cause := wrapError(ErrorTypeUnknown, tree, n, err)
+	render := func(tf typeFormatFunc) string {
+		held := make([]string, len(v.joined))
+		for i, alternative := range v.joined {
+			held[i] = tf(alternative)
+		}
+		return fmt.Sprintf("%s may hold %s after branches join: %s", v.name, strings.Join(held, " or "), cause.messageWith(tf))
+	}
+	return &Error{
+		Type:   ErrorTypeVariableJoin,
+		Tree:   tree,
+		Node:   n,
+		X:      tp,
+		err:    cause,
+		render: render,
+	}
 }
 
 func (s *scope) checkListNode(tree *parse.Tree, dot, prev types.Type, n *parse.ListNode) error {
@@ -579,33 +1029,68 @@ func (s *scope) checkPipeNode(tree *parse.Tree, dot types.Type, n *parse.PipeNod
 		}
 		result = tp
 	}
-	if len(n.Decl) > 0 && len(n.Decl[0].Ident) > 0 {
-		s.variables[n.Decl[0].Ident[0]] = result
+	// Like text/template's evalPipeline, every variable in the pipeline is
+	// bound to its result.
+	var errs []error
+	for _, decl := range n.Decl {
+		if n.IsAssign {
+			if err := s.assign(tree, decl, result); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		s.declare(decl.Ident[0], result)
+	}
+	if err := joinErrors(tree, n, errs...); err != nil {
+		return nil, err
+	}
+	if path, ok := pipePath(n); ok && s.isNonNil(path) {
+		for _, decl := range n.Decl {
+			s.markNonNil(decl.Ident[0])
+		}
 	}
 	return result, nil
 }
 
 func (s *scope) checkIfNode(tree *parse.Tree, dot types.Type, n *parse.IfNode) error {
 	var errs []error
-	if _, err := s.walk(tree, dot, nil, n.Pipe); err != nil {
+	// Variables declared by the pipeline are visible in both branches and
+	// dropped at {{end}}.
+	child := s.child()
+	if _, err := child.walk(tree, dot, nil, n.Pipe); err != nil {
 		errs = append(errs, err)
 	}
-	ifScope := s.child()
-	if _, err := ifScope.walk(tree, dot, nil, n.List); err != nil {
+	ifScope := child.child()
+	ifDot := dot
+	if guard, operand, ok := s.typeGuard(n.Pipe); ok {
+		switch o := operand.(type) {
+		case *parse.DotNode:
+			ifDot = guard
+		case *parse.VariableNode:
+			if len(o.Ident) == 1 {
+				ifScope.narrow(o.Ident[0], guard)
+			}
+		}
+	}
+	ifScope.markNonNil(guardPaths(n.Pipe)...)
+	if _, err := ifScope.walk(tree, ifDot, nil, n.List); err != nil {
 		errs = append(errs, err)
 	}
+	elseScope := child.child()
+	elseScope.markNonNil(negatedGuardPaths(n.Pipe)...)
 	if n.ElseList != nil {
-		elseScope := s.child()
 		if _, err := elseScope.walk(tree, dot, nil, n.ElseList); err != nil {
 			errs = append(errs, err)
 		}
 	}
+	s.join(ifScope.variables, elseScope.variables)
 	return joinErrors(tree, n, errs...)
 }
 
 func (s *scope) checkWithNode(tree *parse.Tree, dot types.Type, n *parse.WithNode) error {
 	var errs []error
 	child := s.child()
+	var branches [][]variable
 	x, err := child.walk(tree, dot, nil, n.Pipe)
 	if err != nil {
 		// The body's dot is unknown when the pipe fails, so only the
@@ -613,19 +1098,61 @@ func (s *scope) checkWithNode(tree *parse.Tree, dot types.Type, n *parse.WithNod
 		errs = append(errs, err)
 	} else {
 		withScope := child.child()
+		// Dot is the pipeline's non-empty value in the body, so guards on
+		// the outer dot's fields no longer apply.
+		withScope.forgetNonNil(".")
+		withScope.markNonNil(slices.DeleteFunc(guardPaths(n.Pipe), isDotPath)...)
+		// Only a converter's result is the guarded value; a predicate's
+		// is its bool.
+		if guard, _, ok := s.typeGuard(n.Pipe); ok && types.AssignableTo(guard, x) {
+			x = guard
+			for _, decl := range n.Pipe.Decl {
+				withScope.narrow(decl.Ident[0], guard)
+			}
+		}
 		if _, err := withScope.walk(tree, x, nil, n.List); err != nil {
 			errs = append(errs, err)
 		}
+		branches = append(branches, withScope.variables)
 	}
+	elseScope := child.child()
 	if n.ElseList != nil {
-		elseScope := child.child()
 		if _, err := elseScope.walk(tree, dot, nil, n.ElseList); err != nil {
 			errs = append(errs, err)
 		}
 	}
+	s.join(append(branches, elseScope.variables)...)
 	return joinErrors(tree, n, errs...)
 }
 
+// typeGuard reports the narrowed type and its operand when pipe ends in a
+// call to a function registered in Global.TypeGuards. The operand is the
+// call's final argument, or the value piped into it:
+//
+//	{{if isUser .}}  {{if . | isUser}}  {{with $u := asUser $v}}
+func (s *scope) typeGuard(pipe *parse.PipeNode) (types.Type, parse.Node, bool) {
+	if pipe == nil || len(pipe.Cmds) == 0 || len(s.global.TypeGuards) == 0 {
+		return nil, nil, false
+	}
+	last := pipe.Cmds[len(pipe.Cmds)-1]
+	ident, ok := last.Args[0].(*parse.IdentifierNode)
+	if !ok {
+		return nil, nil, false
+	}
+	guard, ok := s.global.TypeGuards[ident.Ident]
+	if !ok {
+		return nil, nil, false
+	}
+	switch {
+	case len(last.Args) > 1:
+		return guard, last.Args[len(last.Args)-1], true
+	case len(pipe.Cmds) == 2 && len(pipe.Cmds[0].Args) == 1:
+		return guard, pipe.Cmds[0].Args[0], true
+	default:
+		return guard, nil, true
+	}
+}
+
 func newNumberNodeType(tree *parse.Tree, constant *parse.NumberNode) (types.Type, error) {
 	switch {
 	case constant.IsComplex:
@@ -674,12 +1201,20 @@ func (s *scope) checkTemplateNode(tree *parse.Tree, dot types.Type, n *parse.Tem
 	} else {
 		x = types.Typ[types.UntypedNil]
 	}
+	if s.probing {
+		// The invoked template starts a new variable stack, so it can't
+		// change the types being probed.
+		return joinErrors(tree, n, errs...)
+	}
 	if fn := s.global.InspectTemplateNode; fn != nil && pipeOK {
 		fn(n, tree, x)
 	}
 	childTree, ok := s.global.trees.FindTree(n.Name)
 	if !ok {
 		notFound := newError(ErrorTypeTemplateNotFound, tree, n, "template %q not found", n.Name)
+		if lister, ok := s.global.trees.(TreeLister); ok {
+			notFound.Suggestions = suggest(n.Name, lister.TreeNames())
+		}
 		if pipeOK {
 			notFound.X = x
 		}
@@ -688,11 +1223,11 @@ func (s *scope) checkTemplateNode(tree *parse.Tree, dot types.Type, n *parse.Tem
 	}
 	if pipeOK {
 		childScope := scope{
-			global: s.global,
-			variables: map[string]types.Type{
-				"$": x,
-			},
+			global:        s.global,
+			invokedInLoop: s.loopDepth > 0 || s.invokedInLoop,
+			reports:       s.reports,
 		}
+		childScope.declare("$", x)
 		if _, err := childScope.walk(childTree, x, nil, childTree.Root); err != nil {
 			errs = append(errs, err)
 		}
@@ -724,27 +1259,27 @@ func downgradeUntyped(x types.Type) types.Type {
 	}
 }
 
-func (s *scope) checkFieldNode(tree *parse.Tree, dot types.Type, n *parse.FieldNode, args []types.Type) (types.Type, error) {
-	return s.checkIdentifiers(tree, dot, n, n.Ident, args)
+func (s *scope) checkFieldNode(tree *parse.Tree, dot types.Type, n *parse.FieldNode, argNodes []parse.Node, args []types.Type) (types.Type, error) {
+	return s.checkIdentifiers(tree, dot, n, n.Ident, argNodes, args)
 }
 
 func (s *scope) checkCommandNode(tree *parse.Tree, dot, prev types.Type, cmd *parse.CommandNode) (types.Type, error) {
 	first := cmd.Args[0]
 	switch n := first.(type) {
 	case *parse.FieldNode:
-		argTypes, err := s.argumentTypes(tree, dot, prev, cmd.Args[1:])
+		argTypes, err := s.argumentTypes(tree, dot, prev, cmd.Args[1:], false)
 		if err != nil {
 			return nil, err
 		}
-		return s.checkFieldNode(tree, dot, n, argTypes)
+		return s.checkFieldNode(tree, dot, n, cmd.Args[1:], argTypes)
 	case *parse.ChainNode:
-		argTypes, err := s.argumentTypes(tree, dot, prev, cmd.Args[1:])
+		argTypes, err := s.argumentTypes(tree, dot, prev, cmd.Args[1:], false)
 		if err != nil {
 			return nil, err
 		}
-		return s.checkChainNode(tree, dot, prev, n, argTypes)
+		return s.checkChainNode(tree, dot, prev, n, cmd.Args[1:], argTypes)
 	case *parse.IdentifierNode:
-		argTypes, err := s.argumentTypes(tree, dot, prev, cmd.Args[1:])
+		argTypes, err := s.argumentTypes(tree, dot, prev, cmd.Args[1:], n.Ident == "and")
 		if err != nil {
 			return nil, err
 		}
@@ -759,11 +1294,11 @@ func (s *scope) checkCommandNode(tree *parse.Tree, dot, prev types.Type, cmd *pa
 		}
 		return s.checkPipeNode(tree, dot, n)
 	case *parse.VariableNode:
-		argTypes, err := s.argumentTypes(tree, dot, prev, cmd.Args[1:])
+		argTypes, err := s.argumentTypes(tree, dot, prev, cmd.Args[1:], false)
 		if err != nil {
 			return nil, err
 		}
-		return s.checkVariableNode(tree, n, argTypes)
+		return s.checkVariableNode(tree, n, cmd.Args[1:], argTypes)
 	}
 
 	if err := s.notAFunction(tree, first, cmd.Args, prev); err != nil {
@@ -786,7 +1321,14 @@ func (s *scope) checkCommandNode(tree *parse.Tree, dot, prev types.Type, cmd *pa
 	}
 }
 
-func (s *scope) argumentTypes(tree *parse.Tree, dot types.Type, prev types.Type, args []parse.Node) ([]types.Type, error) {
+// argumentTypes walks a command's arguments. shortCircuit marks the
+// arguments of and, which stops at the first empty one, so each argument
+// is only evaluated when those before it are non-nil.
+func (s *scope) argumentTypes(tree *parse.Tree, dot types.Type, prev types.Type, args []parse.Node, shortCircuit bool) ([]types.Type, error) {
+	if shortCircuit {
+		nonNil := maps.Clone(s.nonNil)
+		defer func() { s.nonNil = nonNil }()
+	}
 	argTypes := make([]types.Type, 0, len(args)+1)
 	var errs []error
 	for _, arg := range args {
@@ -796,6 +1338,9 @@ func (s *scope) argumentTypes(tree *parse.Tree, dot types.Type, prev types.Type,
 			continue
 		}
 		argTypes = append(argTypes, argType)
+		if path, ok := nodePath(arg); ok && shortCircuit {
+			s.markNonNil(path)
+		}
 	}
 	if err := joinErrors(tree, nil, errs...); err != nil {
 		return nil, err
@@ -830,195 +1375,296 @@ func (s *scope) identErr(errType ErrorType, tree *parse.Tree, n parse.Node, iden
 	}).withX(tp)
 }
 
-func (s *scope) checkIdentifiers(tree *parse.Tree, dot types.Type, n parse.Node, idents []string, args []types.Type) (types.Type, error) {
+func (s *scope) checkIdentifiers(tree *parse.Tree, dot types.Type, n parse.Node, idents []string, argNodes []parse.Node, args []types.Type) (types.Type, error) {
 	x := dot
 	for i, ident := range idents {
+		receiver := x
 		x = dereference(x)
-		switch xx := x.(type) {
-		case *types.Map:
-			switch key := xx.Key().Underlying().(type) {
-			case *types.Basic:
-				switch key.Kind() {
-				// case types.Int, types.Int64, types.Int32, types.Int16, types.Int8,
-				//	types.Uint, types.Uint64, types.Uint32, types.Uint16, types.Uint8:
-				case types.Int:
-					x = xx.Elem()
-					_, err := strconv.Atoi(ident)
-					if err != nil {
-						return nil, s.identErr(ErrorTypeMapKey, tree, n, ident, xx, `can't evaluate field one in type %s`, xx)
-					}
-				case types.String:
-					x = xx.Elem()
-				default:
-				}
-				continue
-			default:
-				x = xx.Elem()
+		at := identSpan(n, i, ident)
+		if m, ok := x.Underlying().(*types.Map); ok && !hasMethod(x, s.global.pkg, ident) {
+			// text/template uses the field name as a map key only when a
+			// string is assignable to the key type, so map[UserID]T and
+			// map[int]T cannot be indexed by a field name.
+			if !types.AssignableTo(types.Typ[types.String], m.Key()) {
+				return nil, s.identErr(ErrorTypeMapKey, tree, n, ident, x, "can't evaluate field %s in type %s", ident, x).withSpan(at)
+			}
+			if i == len(idents)-1 && len(args) > 0 {
+				return nil, s.identErr(ErrorTypeNotAFunction, tree, n, ident, x, "%s is not a method but has arguments", ident).withSpan(at)
 			}
+			x = m.Elem()
 			continue
+		}
+		if s.global.Lenient && types.IsInterface(x) {
+			if obj, _, _ := types.LookupFieldOrMethod(x, true, s.global.pkg, ident); obj == nil {
+				return s.uncheckedAccess(tree, n, x), nil
+			}
+		}
+		if !token.IsExported(ident) {
+			e := s.identErr(ErrorTypeFieldNotExported, tree, n, ident, x, "field or method %s is not exported", ident).withSpan(at)
+			e.Suggestions = suggest(ident, memberNames(x))
+			e.Fixes = renameFix(tree, n, i, ident, x)
+			return nil, e
+		}
+		obj, _, _ := types.LookupFieldOrMethod(x, true, s.global.pkg, ident)
+		if obj == nil {
+			render := notFoundMessage(ident, x)
+			notFound := wrapError(ErrorTypeFieldOrMethodNotFound, tree, n, &IdentifierError{
+				Identifier: ident,
+				Type:       x,
+				Cause:      errors.New(render(fullTypeFormat(nil))),
+				render:     render,
+				qualifier:  s.global.Qualifier,
+				fset:       s.global.fileSet,
+			}).withX(x).withSpan(at)
+			if named, ok := x.(*types.Named); ok {
+				notFound.Decl = s.global.fileSet.Position(named.Obj().Pos())
+			}
+			notFound.Suggestions = suggest(ident, memberNames(x))
+			notFound.Fixes = renameFix(tree, n, i, ident, x)
+			return nil, notFound
+		}
+		if s.global.NilPointers {
+			s.checkNilReceiver(tree, n, idents[:i], receiver, obj)
+		}
+		if s.global.Deprecations {
+			s.checkDeprecated(tree, n, x, ident, at, obj)
+		}
+		switch o := obj.(type) {
 		default:
-			if !token.IsExported(ident) {
-				return nil, s.identErr(ErrorTypeFieldNotExported, tree, n, ident, x, "field or method %s is not exported", ident)
+			x = obj.Type()
+		case *types.Func:
+			sig := o.Signature()
+			resultLen := sig.Results().Len()
+			if resultLen < 1 || resultLen > 2 {
+				methodPos := s.global.fileSet.Position(o.Pos())
+				return nil, s.identErr(ErrorTypeBadSignature, tree, n, ident, sig, "function %s has %d return values; should be 1 or 2", ident, resultLen).withDecl(methodPos).withSpan(at)
 			}
-			obj, _, _ := types.LookupFieldOrMethod(x, true, s.global.pkg, ident)
-			if obj == nil {
-				render := notFoundMessage(ident, x)
-				notFound := wrapError(ErrorTypeFieldOrMethodNotFound, tree, n, &IdentifierError{
-					Identifier: ident,
-					Type:       x,
-					Cause:      errors.New(render(fullTypeFormat(nil))),
-					render:     render,
-					qualifier:  s.global.Qualifier,
-					fset:       s.global.fileSet,
-				}).withX(x)
-				if named, ok := x.(*types.Named); ok {
-					notFound.Decl = s.global.fileSet.Position(named.Obj().Pos())
+			if resultLen > 1 {
+				methodPos := s.global.fileSet.Position(obj.Pos())
+				finalResult := sig.Results().At(sig.Results().Len() - 1)
+				errorType := types.Universe.Lookup("error")
+				if !types.Identical(errorType.Type(), finalResult.Type()) {
+					return nil, s.identErr(ErrorTypeBadSignature, tree, n, ident, sig, "invalid function signature for %s: second return value should be error; is %s", ident, finalResult.Type()).withDecl(methodPos).withSpan(at)
 				}
-				return nil, notFound
 			}
-			switch o := obj.(type) {
-			default:
-				x = obj.Type()
-			case *types.Func:
-				sig := o.Signature()
-				resultLen := sig.Results().Len()
-				if resultLen < 1 || resultLen > 2 {
-					methodPos := s.global.fileSet.Position(o.Pos())
-					return nil, s.identErr(ErrorTypeBadSignature, tree, n, ident, sig, "function %s has %d return values; should be 1 or 2", ident, resultLen).withDecl(methodPos)
-				}
-				if resultLen > 1 {
-					methodPos := s.global.fileSet.Position(obj.Pos())
-					finalResult := sig.Results().At(sig.Results().Len() - 1)
-					errorType := types.Universe.Lookup("error")
-					if !types.Identical(errorType.Type(), finalResult.Type()) {
-						return nil, s.identErr(ErrorTypeBadSignature, tree, n, ident, sig, "invalid function signature for %s: second return value should be error; is %s", ident, finalResult.Type()).withDecl(methodPos)
-					}
-				}
-				if i == len(idents)-1 {
-					res, err := checkCallArguments(s.global, ident, sig, args)
-					if err != nil {
-						return nil, wrapError(ErrorTypeCallArguments, tree, n, err)
+			if i == len(idents)-1 {
+				res, err := checkCallArguments(s.global, ident, sig, argNodes, args)
+				if err != nil {
+					e := wrapError(ErrorTypeCallArguments, tree, n, err).withSpan(at)
+					if len(args) == 0 {
+						e.Fixes = argumentsFix(tree, n, i, ident, sig)
 					}
-					return res, nil
+					return nil, e
 				}
-				x = sig.Results().At(0).Type()
-			}
-			if _, ok := x.(*types.Signature); ok && i < len(idents)-1 {
-				return nil, s.identErr(ErrorTypeIdentifierChain, tree, n, ident, x, "identifier chain not supported for type %s", x)
+				return res, nil
 			}
+			x = sig.Results().At(0).Type()
+		}
+		if _, ok := x.(*types.Signature); ok && i < len(idents)-1 {
+			return nil, s.identErr(ErrorTypeIdentifierChain, tree, n, ident, x, "identifier chain not supported for type %s", x).withSpan(at)
 		}
 	}
 	if len(args) > 0 {
-		sig, ok := x.(*types.Signature)
-		if !ok {
-			return nil, s.identErr(ErrorTypeNotAFunction, tree, n, "", x, "expected method or function")
+		// Methods returned above; text/template never calls a field or
+		// variable, even one holding a func.
+		if len(idents) == 0 {
+			return nil, newError(ErrorTypeNotAFunction, tree, n, "can't give argument to non-function %s", n).withX(x)
 		}
-		var name string
-		if len(idents) > 0 {
-			name = idents[len(idents)-1]
+		ident := idents[len(idents)-1]
+		e := s.identErr(ErrorTypeNotAFunction, tree, n, ident, x, "%s has arguments but cannot be invoked as function", ident).
+			withSpan(identSpan(n, len(idents)-1, ident))
+		if _, ok := x.(*types.Signature); ok {
+			e.Fixes = callFix(tree, n)
 		}
-		tp, err := checkCallArguments(s.global, name, sig, args)
-		if err != nil {
-			return nil, wrapError(ErrorTypeCallArguments, tree, n, err)
-		}
-		return tp, nil
+		return nil, e
 	}
 	return x, nil
 }
 
+// uncheckedAccess reports a Lenient access through the interface type x and
+// returns the type of its (unknown) result.
+func (s *scope) uncheckedAccess(tree *parse.Tree, n parse.Node, x types.Type) types.Type {
+	if fn := s.global.InspectUncheckedNode; fn != nil && !s.probing {
+		fn(n, tree, x)
+	}
+	return types.Universe.Lookup("any").Type()
+}
+
+// checkRangeNode mirrors text/template's walkRange: the body's dot is the
+// element, one declared variable holds the element, and two hold the index
+// (or key) and the element. The else list runs with the outer dot.
 func (s *scope) checkRangeNode(tree *parse.Tree, dot types.Type, n *parse.RangeNode) error {
 	child := s.child()
-	pipeType, err := child.walk(tree, dot, nil, n.Pipe)
+	pipeResult, err := child.walk(tree, dot, nil, n.Pipe)
 	if err != nil {
 		return err
 	}
-	pipeType = dereference(pipeType).Underlying()
-	var x types.Type
+	pipeType := dereference(pipeResult).Underlying()
+	var key, elem types.Type
 	switch pt := pipeType.(type) {
 	case *types.Slice:
-		x = pt.Elem()
-		if len(n.Pipe.Decl) == 1 {
-			child.variables[n.Pipe.Decl[0].Ident[0]] = x
-		} else if len(n.Pipe.Decl) > 1 {
-			child.variables[n.Pipe.Decl[0].Ident[0]] = types.Typ[types.Int]
-			child.variables[n.Pipe.Decl[1].Ident[0]] = x
-		}
+		key, elem = types.Typ[types.Int], pt.Elem()
 	case *types.Array:
-		x = pt.Elem()
-		if len(n.Pipe.Decl) == 1 {
-			child.variables[n.Pipe.Decl[0].Ident[0]] = x
-		} else if len(n.Pipe.Decl) > 1 {
-			child.variables[n.Pipe.Decl[0].Ident[0]] = types.Typ[types.Int]
-			child.variables[n.Pipe.Decl[1].Ident[0]] = x
-		}
+		key, elem = types.Typ[types.Int], pt.Elem()
 	case *types.Map:
-		x = pt.Elem()
-		if len(n.Pipe.Decl) == 1 {
-			child.variables[n.Pipe.Decl[0].Ident[0]] = pt.Elem()
-		} else if len(n.Pipe.Decl) > 1 {
-			child.variables[n.Pipe.Decl[0].Ident[0]] = pt.Key()
-			child.variables[n.Pipe.Decl[1].Ident[0]] = pt.Elem()
-		}
+		key, elem = pt.Key(), pt.Elem()
 	case *types.Chan:
-		x = pt.Elem()
-		if len(n.Pipe.Decl) > 1 {
-			child.variables[n.Pipe.Decl[0].Ident[0]] = types.Typ[types.Int] // TODO: this looks odd, I don't think I should permit an index here
-			child.variables[n.Pipe.Decl[1].Ident[0]] = pt.Elem()
+		if pt.Dir() == types.SendOnly {
+			return newError(ErrorTypeRange, tree, n.Pipe, "range over send-only channel %s", pipeResult).withX(pipeResult)
 		}
+		// Unlike a Go range statement, text/template passes the receive
+		// count as the index when a channel range declares two variables.
+		key, elem = types.Typ[types.Int], pt.Elem()
 	case *types.Basic:
-		switch {
-		case pt.Info()&types.IsInteger != 0:
-			tp := types.Universe.Lookup(strings.TrimPrefix(pipeType.String(), "untyped "))
-			x = tp.Type()
-			if len(n.Pipe.Decl) > 0 {
-				child.variables[n.Pipe.Decl[0].Ident[0]] = x
-			}
-		default:
+		if pt.Info()&types.IsInteger == 0 {
 			return newError(ErrorTypeRange, tree, n.Pipe, "range can't iterate over %s", untypedTrimmed{pipeType}).withX(pipeType)
 		}
+		if len(n.Pipe.Decl) > 1 {
+			return newError(ErrorTypeRange, tree, n.Pipe, "can't use %s to iterate over more than one variable", untypedTrimmed{pipeResult}).withX(pipeResult)
+		}
+		// Keep named integer types: range over a Count yields Counts.
+		elem = types.Default(dereference(pipeResult))
 	case *types.Signature:
 		if v1, v2, ok := isIter2(pt); ok {
 			if len(n.Pipe.Decl) > 1 {
-				x = v2
-				child.variables[n.Pipe.Decl[0].Ident[0]] = v1
-				child.variables[n.Pipe.Decl[1].Ident[0]] = v2
+				key, elem = v1, v2
 			} else {
-				x = v1
-				if len(n.Pipe.Decl) > 0 {
-					child.variables[n.Pipe.Decl[0].Ident[0]] = v1
-				}
+				elem = v1
 			}
 		} else if val, ok := isIter(pt); ok {
-			x = val
-			if len(n.Pipe.Decl) == 1 {
-				child.variables[n.Pipe.Decl[0].Ident[0]] = val
-			}
 			if len(n.Pipe.Decl) > 1 {
-				return newError(ErrorTypeRange, tree, n.Pipe, "iter.Seq[T] must not iterate over more than one variable").withX(pipeType)
+				return newError(ErrorTypeRange, tree, n.Pipe, "iter.Seq[T] must not iterate over more than one variable").withX(pipeResult)
 			}
+			elem = val
 		} else {
 			return newError(ErrorTypeRange, tree, n.Pipe, "failed to range over function %s", pipeType).withX(pipeType)
 		}
+	case *types.Interface:
+		if !s.global.Lenient {
+			return newError(ErrorTypeRange, tree, n.Pipe, "failed to range over %s", pipeType).withX(pipeType)
+		}
+		key = s.uncheckedAccess(tree, n.Pipe, pipeResult)
+		elem = key
 	default:
 		return newError(ErrorTypeRange, tree, n.Pipe, "failed to range over %s", pipeType).withX(pipeType)
 	}
+	// The body runs zero or more times, so the types it assigns to
+	// variables flow around the loop's back-edge: the body is probed until
+	// the variables it starts with are stable, then checked once.
+	entry := child
+	if n.Pipe.IsAssign || assignsVariables(n.List) {
+		for range maxLoopPasses {
+			probe := entry.child()
+			probe.probing = true
+			end, _ := probe.checkRangeBody(tree, n, key, elem)
+			next := entry.child()
+			next.join(append([][]variable{entry.variables, end.variables}, end.loop.continues...)...)
+			if sameVariables(next.variables, entry.variables) {
+				break
+			}
+			entry = next
+		}
+	}
 	var errs []error
-	if _, err := child.walk(tree, x, nil, n.List); err != nil {
+	end, err := entry.checkRangeBody(tree, n, key, elem)
+	if err != nil {
 		errs = append(errs, err)
 	}
+	// After one or more iterations the loop exits from the end of the
+	// body, a {{continue}} or a {{break}}; after none, from the else list
+	// when there is one.
+	exits := append([][]variable{end.variables}, end.loop.continues...)
+	exits = append(exits, end.loop.breaks...)
 	if n.ElseList != nil {
-		if _, err := child.walk(tree, x, nil, n.ElseList); err != nil {
+		// The pipeline's variables still hold the pipeline value here.
+		elseScope := child.child()
+		if _, err := elseScope.walk(tree, dot, nil, n.ElseList); err != nil {
 			errs = append(errs, err)
 		}
+		exits = append(exits, elseScope.variables)
+	} else {
+		exits = append(exits, child.variables)
 	}
+	s.join(exits...)
 	return joinErrors(tree, n, errs...)
 }
 
+// maxLoopPasses bounds the passes checkRangeNode makes over a loop body to
+// find the types its variables hold. Each pass can only widen those types,
+// so real templates settle in two or three.
+const maxLoopPasses = 8
+
+// checkRangeBody checks one iteration of n's body, starting with the
+// variables of s, and returns the scope the body ends in.
+func (s *scope) checkRangeBody(tree *parse.Tree, n *parse.RangeNode, key, elem types.Type) (*scope, error) {
+	bodyScope := s.child()
+	bodyScope.loopDepth++
+	bodyScope.loop = new(loopState)
+	var errs []error
+	iteration := func(decl *parse.VariableNode, tp types.Type) {
+		if !n.Pipe.IsAssign {
+			bodyScope.declare(decl.Ident[0], tp)
+			return
+		}
+		if err := bodyScope.assign(tree, decl, tp); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	switch decl := n.Pipe.Decl; len(decl) {
+	case 0:
+	case 1:
+		iteration(decl[0], elem)
+	default:
+		iteration(decl[0], key)
+		iteration(decl[1], elem)
+	}
+	// Like dot, the elements are assumed to be non-nil.
+	bodyScope.forgetNonNil(".")
+	for _, decl := range n.Pipe.Decl {
+		bodyScope.markNonNil(decl.Ident[0])
+	}
+	if _, err := bodyScope.walk(tree, elem, nil, n.List); err != nil {
+		errs = append(errs, err)
+	}
+	return bodyScope, joinErrors(tree, n, errs...)
+}
+
+// assignsVariables reports whether node contains a {{$x = value}}
+// pipeline outside the templates it invokes.
+func assignsVariables(node parse.Node) bool {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		return n != nil && slices.ContainsFunc(n.Nodes, assignsVariables)
+	case *parse.ActionNode:
+		return assignsVariables(n.Pipe)
+	case *parse.PipeNode:
+		return n != nil && (n.IsAssign || slices.ContainsFunc(n.Cmds, func(cmd *parse.CommandNode) bool {
+			return slices.ContainsFunc(cmd.Args, assignsVariables)
+		}))
+	case *parse.ChainNode:
+		return assignsVariables(n.Node)
+	case *parse.IfNode:
+		return assignsBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		return assignsBranch(&n.BranchNode)
+	case *parse.WithNode:
+		return assignsBranch(&n.BranchNode)
+	case *parse.TemplateNode:
+		return assignsVariables(n.Pipe)
+	default:
+		return false
+	}
+}
+
+func assignsBranch(n *parse.BranchNode) bool {
+	return assignsVariables(n.Pipe) || assignsVariables(n.List) || assignsVariables(n.ElseList)
+}
+
 func isIter(signature *types.Signature) (types.Type, bool) {
 	if signature == nil || signature.Variadic() || signature.Results().Len() != 0 || signature.Params().Len() != 1 {
 		return nil, false
 	}
-	yield, ok := signature.Params().At(0).Type().(*types.Signature)
+	yield, ok := signature.Params().At(0).Type().Underlying().(*types.Signature)
 	if !ok || yield.Results().Len() != 1 || yield.Params().Len() != 1 {
 		return nil, false
 	}
@@ -1032,7 +1678,7 @@ func isIter2(signature *types.Signature) (types.Type, types.Type, bool) {
 	if signature == nil || signature.Variadic() || signature.Results().Len() != 0 || signature.Params().Len() != 1 {
 		return nil, nil, false
 	}
-	yield, ok := signature.Params().At(0).Type().(*types.Signature)
+	yield, ok := signature.Params().At(0).Type().Underlying().(*types.Signature)
 	if !ok || yield.Results().Len() != 1 || yield.Params().Len() != 2 {
 		return nil, nil, false
 	}
@@ -1051,13 +1697,21 @@ func (s *scope) checkIdentifierNode(tree *parse.Tree, n *parse.IdentifierNode) (
 		}
 		return tp, err
 	}
-	tp, ok := s.variables[n.Ident]
+	v, ok := s.lookup(n.Ident)
 	if !ok {
 		e := newError(ErrorTypeVariableNotFound, tree, n, "failed to find identifier %s", n.Ident)
 		e.Secondary = s.failed[n.Ident]
 		return nil, e
 	}
-	return tp, nil
+	return v.tp, nil
+}
+
+// hasMethod reports whether tp has a method named ident. Methods on a named
+// map type take precedence over map keys.
+func hasMethod(tp types.Type, pkg *types.Package, ident string) bool {
+	obj, _, _ := types.LookupFieldOrMethod(tp, true, pkg, ident)
+	_, ok := obj.(*types.Func)
+	return ok
 }
 
 func dereference(tp types.Type) types.Type {
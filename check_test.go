@@ -2,12 +2,17 @@ package check_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/format"
+	"go/parser"
+	"go/token"
 	"go/types"
 	"html/template"
 	"io"
+	"os"
+	"path/filepath"
 	"runtime"
 	"slices"
 	"strconv"
@@ -286,6 +291,70 @@ func TestTree(t *testing.T) {
 			Template: `{{.F 32}}`,
 			Data:     MethodWithUint8Param{},
 		},
+		{
+			Name:     "when an uint8 parameter gets a rune literal",
+			Template: `{{.F 'a'}}`,
+			Data:     MethodWithUint8Param{},
+		},
+		{
+			Name:     "when an uint8 parameter gets an overflowing literal",
+			Template: `{{.F 300}}`,
+			Data:     MethodWithUint8Param{},
+			Error: func(t *testing.T, checkErr, execErr error, tp types.Type) {
+				// The runtime silently truncates 300 to 44.
+				require.NoError(t, execErr)
+				require.ErrorContains(t, checkErr, "argument 0 constant 300 overflows uint8")
+				require.Equal(t, check.ErrorTypeCallArguments, findLeafError(t, checkErr).Type)
+			},
+		},
+		{
+			Name:     "when an unsigned parameter gets a negative literal",
+			Template: `{{.F -1}}`,
+			Data:     MethodWithUintParam{},
+			Error: func(t *testing.T, checkErr, execErr error, tp types.Type) {
+				require.ErrorContains(t, execErr, "expected unsigned integer; found -1")
+				require.ErrorContains(t, checkErr, "argument 0 expected unsigned integer; found -1")
+			},
+		},
+		{
+			Name:     "when an int parameter gets a float literal",
+			Template: `{{.F 1.5}}`,
+			Data:     MethodWithIntParam{},
+			Error: func(t *testing.T, checkErr, execErr error, tp types.Type) {
+				require.ErrorContains(t, execErr, "expected integer; found 1.5")
+				require.ErrorContains(t, checkErr, "argument 0 expected integer; found 1.5")
+			},
+		},
+		{
+			Name:     "when an int parameter gets an integral float literal",
+			Template: `{{.F 2.0}}`,
+			Data:     MethodWithIntParam{},
+		},
+		{
+			Name:     "when an int8 function parameter gets an overflowing literal",
+			Template: `{{expectInt8 -129}}`,
+			Data:     Void{},
+			Error: func(t *testing.T, checkErr, execErr error, tp types.Type) {
+				require.ErrorContains(t, checkErr, "argument 0 constant -129 overflows int8")
+			},
+		},
+		{
+			Name:     "when a float32 function parameter gets an overflowing literal",
+			Template: `{{expectFloat32 1e39}}`,
+			Data:     Void{},
+			Error: func(t *testing.T, checkErr, execErr error, tp types.Type) {
+				require.ErrorContains(t, checkErr, "argument 0 constant 1e39 overflows float32")
+			},
+		},
+		{
+			Name:     "when a complex function parameter gets an integer literal",
+			Template: `{{expectComplex128 2}}`,
+			Data:     Void{},
+			Error: func(t *testing.T, checkErr, execErr error, tp types.Type) {
+				require.ErrorContains(t, execErr, "expected complex; found 2")
+				require.ErrorContains(t, checkErr, "argument 0 expected complex; found 2")
+			},
+		},
 		{
 			Name:     "when the method parameter is an uint16",
 			Template: `{{.F 32}}`,
@@ -540,6 +609,67 @@ func TestTree(t *testing.T) {
 			Template: `{{range $k, $v := .Field2}}{{expectFloat64 .}}{{end}}`,
 			Data:     NewIterators(),
 		},
+		{
+			Name:     "range over named integer keeps the named type",
+			Template: `{{range $n := .}}{{printf "%d" $n}}{{.Missing}}{{end}}`,
+			Data:     Count(2),
+			Error: func(t *testing.T, checkErr, execErr error, tp types.Type) {
+				require.ErrorContains(t, execErr, "can't evaluate field Missing in type check_test.Count")
+				require.ErrorContains(t, checkErr, "field or method Missing not found on github.com/typelate/check_test.Count")
+			},
+		},
+		{
+			Name:     "range over integer with two variables",
+			Template: `{{range $i, $n := .}}{{end}}`,
+			Data:     Count(2),
+			Error: func(t *testing.T, checkErr, execErr error, tp types.Type) {
+				require.ErrorContains(t, execErr, "can't use 2 to iterate over more than one variable")
+				require.ErrorContains(t, checkErr, "can't use github.com/typelate/check_test.Count to iterate over more than one variable")
+			},
+		},
+		{
+			Name:     "range over channel with one variable",
+			Template: `{{range $e := .}}{{expectString $e}}{{end}}`,
+			Data:     closedChan("a"),
+		},
+		{
+			Name:     "range over channel with two variables",
+			Template: `{{range $i, $e := .}}{{expectInt $i}}{{expectString $e}}{{expectString .}}{{end}}`,
+			Data:     closedChan("a"),
+		},
+		{
+			Name:     "range over receive-only channel",
+			Template: `{{range .}}{{expectString .}}{{end}}`,
+			Data:     (<-chan string)(closedChan("a")),
+		},
+		{
+			Name:     "range over send-only channel",
+			Template: `{{range .}}{{end}}`,
+			Data:     make(chan<- string),
+			Error: func(t *testing.T, checkErr, execErr error, tp types.Type) {
+				require.ErrorContains(t, execErr, "range over send-only channel")
+				require.ErrorContains(t, checkErr, "range over send-only channel chan<- string")
+				require.Equal(t, check.ErrorTypeRange, findLeafError(t, checkErr).Type)
+			},
+		},
+		{
+			Name:     "range over named iter.Seq type from a method",
+			Template: `{{range $v := .Named}}{{expectInt8 $v}}{{expectInt8 .}}{{end}}`,
+			Data:     NewIterators(),
+		},
+		{
+			Name:     "range else list keeps the outer dot",
+			Template: `{{range .Items}}{{else}}{{expectString .Name}}{{end}}`,
+			Data: struct {
+				Name  string
+				Items []int
+			}{},
+		},
+		{
+			Name:     "range else list sees the pipeline value",
+			Template: `{{range $x := .}}{{expectInt $x}}{{else}}{{len $x}}{{end}}`,
+			Data:     []int{},
+		},
 		{
 			Name:     "when a variable is used",
 			Template: `{{$v := 1}}{{.F $v}}`,
@@ -802,9 +932,87 @@ func TestTree(t *testing.T) {
 			Template: "{{index . 10}}",
 			Data:     [3]int{},
 			Error: func(t *testing.T, checkErr, execErr error, tp types.Type) {
-				t.Skip("need to figure out how to pass type and value back")
+				require.ErrorContains(t, execErr, "index out of range: 10")
+				require.ErrorContains(t, checkErr, "index out of range: 10")
+			},
+		},
+		{
+			Name:     "index at array length",
+			Template: "{{index . 3}}",
+			Data:     [3]int{},
+			Error: func(t *testing.T, checkErr, execErr error, tp types.Type) {
 				require.Error(t, execErr)
-				require.ErrorContains(t, checkErr, "out of range")
+				require.ErrorContains(t, checkErr, "index out of range: 3")
+			},
+		},
+		{
+			Name:     "index of a string",
+			Template: "{{expectUint8 (index . 1)}}",
+			Data:     "abc",
+		},
+		{
+			Name:     "index with a float",
+			Template: "{{index . 1.5}}",
+			Data:     []int{1, 2},
+			Error: func(t *testing.T, checkErr, execErr error, tp types.Type) {
+				require.ErrorContains(t, execErr, "cannot index slice/array with type float64")
+				require.ErrorContains(t, checkErr, "cannot index slice/array with type float64")
+			},
+		},
+		{
+			Name:     "slice of a slice is a slice",
+			Template: "{{range slice . 1}}{{expectInt .}}{{end}}",
+			Data:     []int{1, 2},
+		},
+		{
+			Name:     "slice of an array is a slice",
+			Template: "{{range $i, $v := slice .A 1 2}}{{expectInt $v}}{{end}}",
+			Data:     &struct{ A [3]int }{A: [3]int{1, 2, 3}},
+		},
+		{
+			Name:     "slice of a pointer to an array",
+			Template: "{{range slice . 1}}{{expectInt .}}{{end}}",
+			Data:     &[3]int{1, 2, 3},
+		},
+		{
+			Name:     "slice keeps a named slice type",
+			Template: "{{(slice . 1).Len}}",
+			Data:     Names{"a", "b"},
+		},
+		{
+			Name:     "slice index beyond the array",
+			Template: "{{slice . 4}}",
+			Data:     &[3]int{},
+			Error: func(t *testing.T, checkErr, execErr error, tp types.Type) {
+				require.ErrorContains(t, execErr, "index out of range: 4")
+				require.ErrorContains(t, checkErr, "index out of range: 4")
+			},
+		},
+		{
+			Name:     "slice with a negative index",
+			Template: "{{slice . -1}}",
+			Data:     []int{},
+			Error: func(t *testing.T, checkErr, execErr error, tp types.Type) {
+				require.ErrorContains(t, execErr, "index out of range: -1")
+				require.ErrorContains(t, checkErr, "index out of range: -1")
+			},
+		},
+		{
+			Name:     "slice with low above high",
+			Template: "{{slice . 2 1}}",
+			Data:     []int{1, 2, 3},
+			Error: func(t *testing.T, checkErr, execErr error, tp types.Type) {
+				require.ErrorContains(t, execErr, "invalid slice index: 2 > 1")
+				require.ErrorContains(t, checkErr, "invalid slice index: 2 > 1")
+			},
+		},
+		{
+			Name:     "slice with high above max",
+			Template: "{{slice . 0 2 1}}",
+			Data:     []int{1, 2, 3},
+			Error: func(t *testing.T, checkErr, execErr error, tp types.Type) {
+				require.ErrorContains(t, execErr, "invalid slice index: 2 > 1")
+				require.ErrorContains(t, checkErr, "invalid slice index: 2 > 1")
 			},
 		},
 		{
@@ -822,6 +1030,69 @@ func TestTree(t *testing.T) {
 			Template: "{{($ | echoT).X}}",
 			Data:     tVal,
 		},
+		{
+			Name:     "map with string key",
+			Template: `{{.A}}`,
+			Data:     map[string]int{},
+		},
+		{
+			Name:     "map with interface key",
+			Template: `{{.A}}`,
+			Data:     map[any]int{},
+		},
+		{
+			Name:     "map with int key",
+			Template: `{{.A}}`,
+			Data:     map[int]int{},
+			Error: func(t *testing.T, checkErr, execErr error, tp types.Type) {
+				require.EqualError(t, checkErr, convertTextExecError(t, execErr))
+				require.Equal(t, check.ErrorTypeMapKey, findLeafError(t, checkErr).Type)
+			},
+		},
+		{
+			Name:     "map with uint8 key",
+			Template: `{{.A}}`,
+			Data:     map[uint8]int{},
+			Error: func(t *testing.T, checkErr, execErr error, tp types.Type) {
+				require.EqualError(t, checkErr, convertTextExecError(t, execErr))
+			},
+		},
+		{
+			Name:     "map with named string key",
+			Template: `{{.A}}`,
+			Data:     map[UserID]int{"A": 1},
+			Error: func(t *testing.T, checkErr, execErr error, tp types.Type) {
+				require.ErrorContains(t, execErr, "can't evaluate field A in type map[check_test.UserID]int")
+				require.ErrorContains(t, checkErr, "can't evaluate field A in type map[github.com/typelate/check_test.UserID]int")
+				require.Equal(t, check.ErrorTypeMapKey, findLeafError(t, checkErr).Type)
+			},
+		},
+		{
+			Name:     "map with fmt.Stringer key",
+			Template: `{{.A}}`,
+			Data:     map[fmt.Stringer]int{},
+			Error: func(t *testing.T, checkErr, execErr error, tp types.Type) {
+				require.EqualError(t, checkErr, convertTextExecError(t, execErr))
+			},
+		},
+		{
+			Name:     "named map method takes precedence over key",
+			Template: `{{.Get}}`,
+			Data:     MapWithMethod{},
+		},
+		{
+			Name:     "named map key",
+			Template: `{{.Other}}`,
+			Data:     MapWithMethod{},
+		},
+		{
+			Name:     "map value with arguments",
+			Template: `{{.A 1}}`,
+			Data:     map[string]func(int) int{},
+			Error: func(t *testing.T, checkErr, execErr error, tp types.Type) {
+				require.EqualError(t, checkErr, convertTextExecError(t, execErr))
+			},
+		},
 	} {
 		t.Run(tt.Name, func(t *testing.T) {
 			functions := template.FuncMap{
@@ -1057,3 +1328,588 @@ func TestTemplateNodeTypeHook(t *testing.T) {
 	assert.Contains(t, call.typeString, "struct{", "type should be a struct")
 	assert.Contains(t, call.typeString, "string", "type should contain string field")
 }
+
+func TestGlobal_TypeGuards(t *testing.T) {
+	pkg := types.NewPackage("example.com/app", "app")
+	anyType := types.Universe.Lookup("any").Type()
+	user := types.NewNamed(types.NewTypeName(token.NoPos, pkg, "User", nil), types.NewStruct([]*types.Var{
+		types.NewField(token.NoPos, pkg, "Name", types.Typ[types.String], false),
+	}, nil), nil)
+	page := types.NewStruct([]*types.Var{
+		types.NewField(token.NoPos, pkg, "Author", anyType, false),
+	}, nil)
+	guardSig := func(result types.Type) *types.Signature {
+		return types.NewSignatureType(nil, nil, nil,
+			types.NewTuple(types.NewVar(token.NoPos, pkg, "v", anyType)),
+			types.NewTuple(types.NewVar(token.NoPos, pkg, "", result)),
+			false)
+	}
+	functions := check.Functions{
+		"isUser": guardSig(types.Typ[types.Bool]),
+		"asUser": guardSig(anyType),
+	}
+
+	for _, tt := range []struct {
+		Name     string
+		Template string
+		Data     types.Type
+		Error    string
+	}{
+		{
+			Name:     "if guard narrows dot",
+			Template: `{{if isUser .}}{{.Name}}{{end}}`,
+			Data:     anyType,
+		},
+		{
+			Name:     "if guard with piped operand narrows dot",
+			Template: `{{if . | isUser}}{{.Name}}{{end}}`,
+			Data:     anyType,
+		},
+		{
+			Name:     "if guard narrows a variable",
+			Template: `{{$a := .Author}}{{if isUser $a}}{{$a.Name}}{{end}}`,
+			Data:     page,
+		},
+		{
+			Name:     "if guard does not narrow the else branch",
+			Template: `{{if isUser .}}{{else}}{{.Name}}{{end}}`,
+			Data:     anyType,
+			Error:    "field or method Name not found on any",
+		},
+		{
+			Name:     "with guard sets dot",
+			Template: `{{with asUser .Author}}{{.Name}}{{end}}`,
+			Data:     page,
+		},
+		{
+			Name:     "with guard sets the declared variable",
+			Template: `{{with $u := asUser .Author}}{{$u.Name}}{{end}}`,
+			Data:     page,
+		},
+		{
+			Name:     "with predicate leaves dot a bool",
+			Template: `{{with isUser .Author}}{{.Name}}{{end}}`,
+			Data:     page,
+			Error:    "field or method Name not found on bool",
+		},
+		{
+			Name:     "narrowed body is still checked",
+			Template: `{{with asUser .Author}}{{.Missing}}{{end}}`,
+			Data:     page,
+			Error:    "field or method Missing not found on example.com/app.User",
+		},
+		{
+			Name:     "without a guard interface data fails",
+			Template: `{{.Author.Name}}`,
+			Data:     page,
+			Error:    "field or method Name not found on any",
+		},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			tmpl, err := template.New("guard.gohtml").Funcs(template.FuncMap{
+				"isUser": func(any) bool { return false },
+				"asUser": func(any) any { return nil },
+			}).Parse(tt.Template)
+			require.NoError(t, err)
+
+			global := check.NewGlobal(pkg, token.NewFileSet(), findHTMLTemplateTree(tmpl), functions)
+			global.TypeGuards = map[string]types.Type{
+				"isUser": user,
+				"asUser": user,
+			}
+			checkErr := check.Execute(global, tmpl.Tree, tt.Data)
+			if tt.Error == "" {
+				require.NoError(t, checkErr)
+				return
+			}
+			require.ErrorContains(t, checkErr, tt.Error)
+		})
+	}
+}
+
+func TestGlobal_Lenient(t *testing.T) {
+	pkg := types.NewPackage("example.com/app", "app")
+	anyType := types.Universe.Lookup("any").Type()
+	data := types.NewMap(types.Typ[types.String], anyType)
+
+	for _, tt := range []struct {
+		Name      string
+		Template  string
+		Unchecked []string
+		Error     string
+	}{
+		{
+			Name:      "field through a map element",
+			Template:  `{{.User.Name}}`,
+			Unchecked: []string{".User.Name"},
+		},
+		{
+			Name:      "lower case map key through a map element",
+			Template:  `{{.user.name}}`,
+			Unchecked: []string{".user.name"},
+		},
+		{
+			Name:      "range over a map element",
+			Template:  `{{range $i, $v := .Items}}{{$v.Name}}{{end}}`,
+			Unchecked: []string{"$i, $v := .Items", "$v.Name"},
+		},
+		{
+			Name:     "typed values are still checked",
+			Template: `{{len .User}}`,
+			Error:    "built-in len expects the first argument to be an array, slice, map, or string got any",
+		},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			tmpl, err := template.New("lenient.gohtml").Parse(tt.Template)
+			require.NoError(t, err)
+
+			global := check.NewGlobal(pkg, token.NewFileSet(), findHTMLTemplateTree(tmpl), check.Functions{})
+			global.Lenient = true
+			var unchecked []string
+			global.InspectUncheckedNode = func(node parse.Node, _ *parse.Tree, tp types.Type) {
+				unchecked = append(unchecked, node.String())
+				require.True(t, types.IsInterface(tp))
+			}
+			checkErr := check.Execute(global, tmpl.Tree, data)
+			if tt.Error != "" {
+				require.ErrorContains(t, checkErr, tt.Error)
+				return
+			}
+			require.NoError(t, checkErr)
+			require.Equal(t, tt.Unchecked, unchecked)
+		})
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		tmpl, err := template.New("strict.gohtml").Parse(`{{.User.Name}}`)
+		require.NoError(t, err)
+		global := check.NewGlobal(pkg, token.NewFileSet(), findHTMLTemplateTree(tmpl), check.Functions{})
+		require.ErrorContains(t, check.Execute(global, tmpl.Tree, data), "field or method Name not found on any")
+	})
+}
+
+func TestGlobal_NilPointers(t *testing.T) {
+	pkg := types.NewPackage("example.com/app", "app")
+	newNamed := func(name string, fields ...*types.Var) *types.Named {
+		return types.NewNamed(types.NewTypeName(token.NoPos, pkg, name, nil), types.NewStruct(fields, nil), nil)
+	}
+	profile := newNamed("Profile",
+		types.NewField(token.NoPos, pkg, "Name", types.Typ[types.String], false),
+	)
+	user := newNamed("User",
+		types.NewField(token.NoPos, pkg, "Name", types.Typ[types.String], false),
+		types.NewField(token.NoPos, pkg, "Profile", types.NewPointer(profile), false),
+	)
+	user.AddMethod(types.NewFunc(token.NoPos, pkg, "Display", types.NewSignatureType(
+		types.NewVar(token.NoPos, pkg, "u", types.NewPointer(user)), nil, nil, nil,
+		types.NewTuple(types.NewVar(token.NoPos, pkg, "", types.Typ[types.String])), false)))
+	stringer := types.NewInterfaceType([]*types.Func{
+		types.NewFunc(token.NoPos, pkg, "String", types.NewSignatureType(nil, nil, nil, nil,
+			types.NewTuple(types.NewVar(token.NoPos, pkg, "", types.Typ[types.String])), false)),
+	}, nil).Complete()
+	data := types.NewPointer(newNamed("Page",
+		types.NewField(token.NoPos, pkg, "User", types.NewPointer(user), false),
+		types.NewField(token.NoPos, pkg, "Users", types.NewSlice(types.NewPointer(user)), false),
+		types.NewField(token.NoPos, pkg, "Stringer", stringer, false),
+	))
+
+	// parseWithComments keeps comment nodes, which template.Parse drops.
+	parseWithComments := func(t *testing.T, text string) (*parse.Tree, check.TreeFinder) {
+		t.Helper()
+		tree := parse.New("nil.gohtml")
+		tree.Mode = parse.ParseComments | parse.SkipFuncCheck
+		trees := make(map[string]*parse.Tree)
+		_, err := tree.Parse(text, "", "", trees)
+		require.NoError(t, err)
+		return trees["nil.gohtml"], check.FindTreeFunc(func(name string) (*parse.Tree, bool) {
+			tree, ok := trees[name]
+			return tree, ok
+		})
+	}
+
+	for _, tt := range []struct {
+		Name     string
+		Template string
+		Flagged  []string
+	}{
+		{Name: "unguarded pointer field", Template: `{{.User.Name}}`, Flagged: []string{".User"}},
+		{Name: "with", Template: `{{with .User}}{{.Name}}{{end}}`},
+		{Name: "if on the same path", Template: `{{if .User}}{{.User.Name}}{{end}}`},
+		{Name: "else of if", Template: `{{if .User}}{{else}}{{.User.Name}}{{end}}`, Flagged: []string{".User"}},
+		{Name: "else of if not", Template: `{{if not .User}}{{else}}{{.User.Profile}}{{end}}`},
+		{Name: "if and", Template: `{{if and .User .User.Profile}}{{.User.Profile.Name}}{{end}}`},
+		{Name: "pointer method", Template: `{{.User.Display}}`},
+		{Name: "range elements", Template: `{{range .Users}}{{.Name}}{{end}}`},
+		{Name: "declared variable", Template: `{{$u := .User}}{{$u.Name}}`, Flagged: []string{"$u"}},
+		{Name: "variable declared from a guarded path", Template: `{{if .User}}{{$u := .User}}{{$u.Name}}{{end}}`},
+		{Name: "with variable", Template: `{{with $u := .User}}{{$u.Profile.Name}}{{end}}`, Flagged: []string{"$u.Profile"}},
+		{Name: "with does not guard the outer dot", Template: `{{with .User}}{{$.User.Name}}{{end}}`, Flagged: []string{"$.User"}},
+		{Name: "with on a root path", Template: `{{with $.User}}{{$.User.Name}}{{end}}`},
+		{Name: "interface method", Template: `{{.Stringer.String}}`, Flagged: []string{".Stringer"}},
+		{Name: "nonnil comment", Template: `{{/* check:nonnil .User.Profile */}}{{.User.Profile.Name}}`},
+		{Name: "nonnil comment ends with its block", Template: `{{if true}}{{/* check:nonnil .User */}}{{end}}{{.User.Name}}`, Flagged: []string{".User"}},
+		{Name: "assignment drops the guard", Template: `{{$u := .User}}{{if $u}}{{$u = $.User}}{{$u.Name}}{{end}}`, Flagged: []string{"$u"}},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			tree, trees := parseWithComments(t, tt.Template)
+			global := check.NewGlobal(pkg, token.NewFileSet(), trees, check.Functions{})
+			global.NilPointers = true
+
+			var flagged []string
+			if checkErr, ok := errors.AsType[*check.Error](check.Execute(global, tree, data)); ok {
+				for e := range checkErr.All {
+					if e.Type != check.ErrorTypeNilPointer {
+						continue
+					}
+					message, _, _ := strings.Cut(e.Error(), " is not guarded")
+					flagged = append(flagged, message[strings.LastIndex(message, ": ")+2:])
+				}
+			}
+			require.Equal(t, tt.Flagged, flagged)
+		})
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		tree, trees := parseWithComments(t, `{{.User.Profile.Name}}`)
+		global := check.NewGlobal(pkg, token.NewFileSet(), trees, check.Functions{})
+		require.NoError(t, check.Execute(global, tree, data))
+	})
+}
+
+func TestGlobal_Deprecations(t *testing.T) {
+	const source = `package app
+
+type Page struct {
+	// Title is the page title.
+	//
+	// Deprecated: Use Heading
+	// instead.
+	Title   string
+	Heading string
+}
+
+// Deprecated: Summaries are no longer shown.
+func (Page) Summary() string { return "" }
+`
+	filename := filepath.Join(t.TempDir(), "app.go")
+	require.NoError(t, os.WriteFile(filename, []byte(source), 0o644))
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, source, 0)
+	require.NoError(t, err)
+	pkg, err := new(types.Config).Check("example.com/app", fset, []*ast.File{file}, nil)
+	require.NoError(t, err)
+	page := pkg.Scope().Lookup("Page").Type()
+
+	execute := func(t *testing.T, text string, deprecations bool) error {
+		t.Helper()
+		templ := template.Must(template.New("page").Parse(text))
+		global := check.NewGlobal(pkg, fset, nil, check.Functions{})
+		global.Deprecations = deprecations
+		return check.Execute(global, templ.Tree, page)
+	}
+
+	t.Run("field", func(t *testing.T) {
+		checkErr, ok := errors.AsType[*check.Error](execute(t, `{{.Title}}{{.Heading}}`, true))
+		require.True(t, ok)
+		require.Equal(t, check.ErrorTypeDeprecated, checkErr.Type)
+		require.Equal(t, check.SeverityWarning, checkErr.Severity)
+		require.Equal(t, filename, checkErr.Decl.Filename)
+		require.Equal(t, 8, checkErr.Decl.Line)
+		require.EqualError(t, checkErr, `page:1:2: warning: executing "page" at <.Title>: example.com/app.Page.Title is deprecated: Use Heading instead.`)
+	})
+	t.Run("method", func(t *testing.T) {
+		checkErr, ok := errors.AsType[*check.Error](execute(t, `{{.Summary}}`, true))
+		require.True(t, ok)
+		require.Equal(t, check.SeverityWarning, checkErr.Severity)
+		require.ErrorContains(t, checkErr, "example.com/app.Page.Summary is deprecated: Summaries are no longer shown.")
+	})
+	t.Run("disabled by default", func(t *testing.T) {
+		require.NoError(t, execute(t, `{{.Title}}{{.Summary}}`, false))
+	})
+}
+
+func TestExecute_loop_control(t *testing.T) {
+	pkg := types.NewPackage("example.com/app", "app")
+	data := types.NewSlice(types.Typ[types.Int])
+
+	// The parser rejects {{break}} and {{continue}} outside {{range}}, so
+	// misplaced nodes are moved out of a loop the way AddParseTree users
+	// and other tools can.
+	loopControl := func(t *testing.T, keyword string) parse.Node {
+		t.Helper()
+		donor := template.Must(template.New("donor").Parse(`{{range .}}{{` + keyword + `}}{{end}}`))
+		return donor.Tree.Root.Nodes[0].(*parse.RangeNode).List.Nodes[0]
+	}
+
+	t.Run("inside range", func(t *testing.T) {
+		tmpl := template.Must(template.New("loop.gohtml").Parse(`{{range .}}{{if eq . 1}}{{continue}}{{end}}{{break}}{{end}}`))
+		global := check.NewGlobal(pkg, token.NewFileSet(), findHTMLTemplateTree(tmpl), check.DefaultFunctions(pkg))
+		require.NoError(t, check.Execute(global, tmpl.Tree, data))
+	})
+
+	t.Run("outside range", func(t *testing.T) {
+		tmpl := template.Must(template.New("loop.gohtml").Parse(`{{range .}}{{end}}`))
+		tmpl.Tree.Root.Nodes = append(tmpl.Tree.Root.Nodes, loopControl(t, "break"))
+		global := check.NewGlobal(pkg, token.NewFileSet(), findHTMLTemplateTree(tmpl), check.Functions{})
+
+		leaf := findLeafError(t, check.Execute(global, tmpl.Tree, data))
+		require.Equal(t, check.ErrorTypeLoopControl, leaf.Type)
+		require.ErrorContains(t, leaf, "{{break}} outside {{range}}")
+	})
+
+	t.Run("in range else list", func(t *testing.T) {
+		tmpl := template.Must(template.New("loop.gohtml").Parse(`{{range .}}{{else}}{{end}}`))
+		rangeNode := tmpl.Tree.Root.Nodes[0].(*parse.RangeNode)
+		rangeNode.ElseList.Nodes = append(rangeNode.ElseList.Nodes, loopControl(t, "continue"))
+		global := check.NewGlobal(pkg, token.NewFileSet(), findHTMLTemplateTree(tmpl), check.Functions{})
+
+		require.ErrorContains(t, check.Execute(global, tmpl.Tree, data), "{{continue}} outside {{range}}")
+	})
+
+	t.Run("in a template invoked from a loop", func(t *testing.T) {
+		tmpl := template.Must(template.New("loop.gohtml").Parse(`{{range .}}{{template "item" .}}{{end}}`))
+		item := template.Must(template.New("item").Parse(`item`))
+		item.Tree.Root.Nodes = append(item.Tree.Root.Nodes, loopControl(t, "break"))
+		_, err := tmpl.AddParseTree("item", item.Tree)
+		require.NoError(t, err)
+		global := check.NewGlobal(pkg, token.NewFileSet(), findHTMLTemplateTree(tmpl), check.Functions{})
+
+		leaf := findLeafError(t, check.Execute(global, tmpl.Tree, data))
+		require.Equal(t, check.ErrorTypeLoopControl, leaf.Type)
+		require.ErrorContains(t, leaf, `{{break}} in template "item" affects the {{range}} that invoked it`)
+	})
+
+	t.Run("in a loop of an invoked template", func(t *testing.T) {
+		tmpl := template.Must(template.New("loop.gohtml").Parse(`{{define "item"}}{{range .}}{{break}}{{end}}{{end}}{{range .}}{{template "item" $}}{{end}}`))
+		global := check.NewGlobal(pkg, token.NewFileSet(), findHTMLTemplateTree(tmpl), check.Functions{})
+		require.NoError(t, check.Execute(global, tmpl.Tree, data))
+	})
+}
+
+func TestExecute_variable_scope(t *testing.T) {
+	pkg := types.NewPackage("example.com/app", "app")
+	data := types.NewStruct([]*types.Var{
+		types.NewField(token.NoPos, pkg, "Name", types.Typ[types.String], false),
+		types.NewField(token.NoPos, pkg, "Count", types.Typ[types.Int], false),
+		types.NewField(token.NoPos, pkg, "Items", types.NewSlice(types.Typ[types.Int]), false),
+	}, nil)
+	stringSig := types.NewSignatureType(nil, nil, nil,
+		types.NewTuple(types.NewVar(token.NoPos, pkg, "s", types.Typ[types.String])),
+		types.NewTuple(types.NewVar(token.NoPos, pkg, "", types.Typ[types.String])),
+		false)
+	functions := check.Functions{"expectString": stringSig}
+	funcMap := template.FuncMap{"expectString": func(s string) string { return s }}
+
+	for _, tt := range []struct {
+		Name       string
+		Template   string
+		Assignment check.AssignmentPolicy
+		Error      string
+		ErrorType  check.ErrorType
+	}{
+		{
+			Name:     "if pipeline variable is visible in both branches",
+			Template: `{{if $x := .Name}}{{expectString $x}}{{else}}{{expectString $x}}{{end}}`,
+		},
+		{
+			Name:     "nested assignment updates the outer declaration",
+			Template: `{{$x := ""}}{{if true}}{{$x = .Name}}{{end}}{{expectString $x}}`,
+		},
+		{
+			Name:     "nested declaration shadows until end",
+			Template: `{{$x := .Name}}{{if true}}{{$x := .Count}}{{$x = 1}}{{end}}{{expectString $x}}`,
+		},
+		{
+			Name:     "range assignment sets existing variables",
+			Template: `{{$i := 0}}{{$v := 0}}{{range $i, $v = .Items}}{{end}}{{$i}}{{$v}}`,
+		},
+		{
+			Name:     "reassigned variable holds the new type",
+			Template: `{{$x := .Name}}{{$x = .Count}}{{expectString $x}}`,
+			Error:    "argument 0 has type int expected string",
+		},
+		{
+			Name:       "strict policy rejects a type change",
+			Template:   `{{$x := .Name}}{{$x = .Count}}`,
+			Assignment: check.AssignmentStrict,
+			Error:      "can't assign int to $x of type string",
+			ErrorType:  check.ErrorTypeAssignment,
+		},
+		{
+			Name:       "strict policy accepts an assignable value",
+			Template:   `{{$x := 0}}{{$x = .Count}}{{$x = 2}}`,
+			Assignment: check.AssignmentStrict,
+		},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			tmpl, err := template.New("scope.gohtml").Funcs(funcMap).Parse(tt.Template)
+			require.NoError(t, err)
+
+			global := check.NewGlobal(pkg, token.NewFileSet(), findHTMLTemplateTree(tmpl), functions)
+			global.Assignment = tt.Assignment
+			checkErr := check.Execute(global, tmpl.Tree, data)
+			if tt.Error == "" {
+				require.NoError(t, checkErr)
+				return
+			}
+			require.ErrorContains(t, checkErr, tt.Error)
+			if tt.ErrorType != check.ErrorTypeUnknown {
+				require.Equal(t, tt.ErrorType, findLeafError(t, checkErr).Type)
+			}
+		})
+	}
+
+	for _, keyword := range []string{"if", "with", "range"} {
+		t.Run(keyword+" pipeline variable is dropped at end", func(t *testing.T) {
+			// The parser rejects uses of $x after {{end}}, so the use is
+			// moved out of the body that can see it.
+			tmpl := template.Must(template.New("scope.gohtml").Parse(`{{` + keyword + ` $x := .Items}}{{$x}}{{end}}`))
+			var body *parse.ListNode
+			switch n := tmpl.Tree.Root.Nodes[0].(type) {
+			case *parse.IfNode:
+				body = n.List
+			case *parse.WithNode:
+				body = n.List
+			case *parse.RangeNode:
+				body = n.List
+			}
+			tmpl.Tree.Root.Nodes = append(tmpl.Tree.Root.Nodes, body.Nodes[0])
+			global := check.NewGlobal(pkg, token.NewFileSet(), findHTMLTemplateTree(tmpl), functions)
+
+			leaf := findLeafError(t, check.Execute(global, tmpl.Tree, data))
+			require.Equal(t, check.ErrorTypeVariableNotFound, leaf.Type)
+			require.ErrorContains(t, leaf, "variable $x not found")
+		})
+	}
+
+	t.Run("assignment to an undeclared variable", func(t *testing.T) {
+		// The parser rejects {{$y = 1}} without a declaration, so the
+		// assignment is moved out of the scope that declared $y.
+		tmpl := template.Must(template.New("scope.gohtml").Parse(`{{if true}}{{$y := 0}}{{$y = 1}}{{end}}`))
+		body := tmpl.Tree.Root.Nodes[0].(*parse.IfNode).List
+		tmpl.Tree.Root.Nodes = append(tmpl.Tree.Root.Nodes, body.Nodes[1])
+		global := check.NewGlobal(pkg, token.NewFileSet(), findHTMLTemplateTree(tmpl), functions)
+
+		leaf := findLeafError(t, check.Execute(global, tmpl.Tree, data))
+		require.Equal(t, check.ErrorTypeVariableNotFound, leaf.Type)
+		require.ErrorContains(t, leaf, "undefined variable: $y")
+	})
+}
+
+func TestExecute_variable_flow(t *testing.T) {
+	pkg := types.NewPackage("example.com/app", "app")
+	newNamed := func(name string, fields ...*types.Var) *types.Named {
+		return types.NewNamed(types.NewTypeName(token.NoPos, pkg, name, nil), types.NewStruct(fields, nil), nil)
+	}
+	user := newNamed("User",
+		types.NewField(token.NoPos, pkg, "Name", types.Typ[types.String], false),
+	)
+	team := newNamed("Team",
+		types.NewField(token.NoPos, pkg, "Name", types.Typ[types.String], false),
+		types.NewField(token.NoPos, pkg, "Size", types.Typ[types.Int], false),
+	)
+	data := types.NewStruct([]*types.Var{
+		types.NewField(token.NoPos, pkg, "Name", types.Typ[types.String], false),
+		types.NewField(token.NoPos, pkg, "Count", types.Typ[types.Int], false),
+		types.NewField(token.NoPos, pkg, "Items", types.NewSlice(types.Typ[types.Int]), false),
+		types.NewField(token.NoPos, pkg, "User", user, false),
+		types.NewField(token.NoPos, pkg, "Team", team, false),
+		types.NewField(token.NoPos, pkg, "Users", types.NewSlice(user), false),
+	}, nil)
+	stringSig := types.NewSignatureType(nil, nil, nil,
+		types.NewTuple(types.NewVar(token.NoPos, pkg, "s", types.Typ[types.String])),
+		types.NewTuple(types.NewVar(token.NoPos, pkg, "", types.Typ[types.String])),
+		false)
+	functions := check.Functions{"expectString": stringSig}
+	funcMap := template.FuncMap{"expectString": func(s string) string { return s }}
+
+	for _, tt := range []struct {
+		Name      string
+		Template  string
+		Error     string
+		ErrorType check.ErrorType
+	}{
+		{
+			Name:     "if and else assign the same type",
+			Template: `{{$x := 0}}{{if .Count}}{{$x = .Name}}{{else}}{{$x = "none"}}{{end}}{{expectString $x}}`,
+		},
+		{
+			Name:     "if without else joins with the declared type",
+			Template: `{{$x := .Name}}{{if .Count}}{{$x = .Count}}{{end}}{{expectString $x}}`,
+			Error:    "argument 0 has type any expected string",
+		},
+		{
+			Name:     "field shared by every joined type",
+			Template: `{{$x := .User}}{{if .Count}}{{$x = .Team}}{{end}}{{expectString $x.Name}}`,
+		},
+		{
+			Name:      "field missing from a joined type",
+			Template:  `{{$x := .User}}{{if .Count}}{{$x = .Team}}{{end}}{{$x.Size}}`,
+			Error:     "$x may hold example.com/app.Team or example.com/app.User after branches join: field or method Size not found on example.com/app.User",
+			ErrorType: check.ErrorTypeVariableJoin,
+		},
+		{
+			Name:     "with body assignment",
+			Template: `{{$x := .Name}}{{with .User}}{{$x = .}}{{end}}{{$x.Name}}`,
+			Error:    "$x may hold example.com/app.User or string after branches join",
+		},
+		{
+			Name:     "range without else may not run",
+			Template: `{{$x := .Name}}{{range .Items}}{{$x = .}}{{end}}{{expectString $x}}`,
+			Error:    "argument 0 has type any expected string",
+		},
+		{
+			Name:     "range else runs when the body does not",
+			Template: `{{$x := .Name}}{{range .Users}}{{$x = .}}{{else}}{{$x = $.User}}{{end}}{{expectString $x.Name}}`,
+		},
+		{
+			Name:      "loop back-edge carries the assigned type",
+			Template:  `{{$prev := .Team}}{{range .Users}}{{$prev.Size}}{{$prev = .}}{{end}}`,
+			Error:     "$prev may hold example.com/app.Team or example.com/app.User after branches join",
+			ErrorType: check.ErrorTypeVariableJoin,
+		},
+		{
+			Name:     "break exits with the types it sees",
+			Template: `{{$x := .User}}{{range .Items}}{{if .}}{{$x = $.Name}}{{break}}{{end}}{{$x = $.User}}{{end}}{{$x.Name}}`,
+			Error:    "field or method Name not found on string",
+		},
+		{
+			Name:     "continue reaches the next iteration",
+			Template: `{{$x := .User}}{{range .Items}}{{$x.Name}}{{if .}}{{$x = $.Count}}{{continue}}{{end}}{{$x = $.User}}{{end}}`,
+			Error:    "field or method Name not found on int",
+		},
+		{
+			// Like walkRange, the pipeline assigns $u the slice before the
+			// first iteration, so it still holds it when there is none.
+			Name:     "range assignment holds the pipeline value when empty",
+			Template: `{{$u := .User}}{{range $u = .Users}}{{end}}{{$u.Name}}`,
+			Error:    "$u may hold example.com/app.User or []example.com/app.User after branches join",
+		},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			tmpl, err := template.New("flow.gohtml").Funcs(funcMap).Parse(tt.Template)
+			require.NoError(t, err)
+
+			global := check.NewGlobal(pkg, token.NewFileSet(), findHTMLTemplateTree(tmpl), functions)
+			checkErr := check.Execute(global, tmpl.Tree, data)
+			if tt.Error == "" {
+				require.NoError(t, checkErr)
+				return
+			}
+			require.ErrorContains(t, checkErr, tt.Error)
+			if tt.ErrorType != check.ErrorTypeUnknown {
+				require.Equal(t, tt.ErrorType, findLeafError(t, checkErr).Type)
+			}
+		})
+	}
+
+	t.Run("probing a loop body does not call inspectors", func(t *testing.T) {
+		tmpl := template.Must(template.New("flow.gohtml").Parse(`{{$x := .Name}}{{range .Items}}{{template "item" .}}{{$x = .}}{{end}}{{define "item"}}{{end}}`))
+		global := check.NewGlobal(pkg, token.NewFileSet(), findHTMLTemplateTree(tmpl), functions)
+		var calls int
+		global.InspectTemplateNode = func(*parse.TemplateNode, *parse.Tree, types.Type) { calls++ }
+
+		require.NoError(t, check.Execute(global, tmpl.Tree, data))
+		require.Equal(t, 1, calls)
+	})
+}
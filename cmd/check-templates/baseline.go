@@ -0,0 +1,159 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/typelate/check"
+)
+
+// baselineFile is the JSON form of a baseline: the failures a package had
+// when the baseline was written, which -baseline check then tolerates.
+type baselineFile struct {
+	Errors []baselineEntry `json:"errors"`
+}
+
+// baselineEntry counts the failures sharing a key. Failures are keyed by
+// the file and template they are in, the text of the failing node, and
+// the error type rather than by line, so a baseline survives edits that
+// only move them.
+type baselineEntry struct {
+	File     string `json:"file"`
+	Template string `json:"template"`
+	Node     string `json:"node"`
+	Type     string `json:"type"`
+	Count    int    `json:"count"`
+}
+
+type baselineKey struct {
+	file, template, node, errorType string
+}
+
+// baseline maps each failure key to the number of failures with that key.
+type baseline map[baselineKey]int
+
+// newBaselineKey keys e with its file relative to dir, so a baseline
+// written in one checkout applies in another.
+func newBaselineKey(dir string, e *check.Error) baselineKey {
+	key := baselineKey{file: e.Start.Filename, errorType: e.Type.String()}
+	if e.Tree != nil {
+		key.template = e.Tree.Name
+		if key.file == "" {
+			key.file = e.Tree.ParseName
+		}
+	}
+	if e.Node != nil {
+		key.node = e.Node.String()
+	}
+	if rel, err := filepath.Rel(dir, key.file); err == nil && filepath.IsAbs(key.file) {
+		key.file = filepath.ToSlash(rel)
+	}
+	return key
+}
+
+// add counts every error-severity failure in err that skip does not
+// report. Warnings never fail the check, so they are left out.
+func (b baseline) add(dir string, err error, skip func(*check.Error) bool) {
+	root, ok := errors.AsType[*check.Error](err)
+	if !ok {
+		return
+	}
+	for e := range root.All {
+		if e.Type != check.ErrorTypeAggregate && e.Severity == check.SeverityError && !skip(e) {
+			b[newBaselineKey(dir, e)]++
+		}
+	}
+}
+
+// consumeFunc returns a func reporting whether a failure is in the
+// baseline. Each recorded failure excuses one failure with its key; the
+// counts left over afterwards are the failures that were fixed.
+func (b baseline) consumeFunc(dir string) func(*check.Error) bool {
+	return func(e *check.Error) bool {
+		if e.Severity != check.SeverityError {
+			return false
+		}
+		key := newBaselineKey(dir, e)
+		if b[key] == 0 {
+			return false
+		}
+		b[key]--
+		return true
+	}
+}
+
+// entries lists the baseline sorted by key.
+func (b baseline) entries() []baselineEntry {
+	var entries []baselineEntry
+	for key, count := range b {
+		if count > 0 {
+			entries = append(entries, baselineEntry{
+				File:     key.file,
+				Template: key.template,
+				Node:     key.node,
+				Type:     key.errorType,
+				Count:    count,
+			})
+		}
+	}
+	slices.SortFunc(entries, func(a, b baselineEntry) int {
+		return cmp.Or(
+			cmp.Compare(a.File, b.File),
+			cmp.Compare(a.Template, b.Template),
+			cmp.Compare(a.Node, b.Node),
+			cmp.Compare(a.Type, b.Type),
+		)
+	})
+	return entries
+}
+
+func readBaseline(path string) (baseline, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file baselineFile
+	if err := json.Unmarshal(buf, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	b := make(baseline)
+	for _, entry := range file.Errors {
+		b[baselineKey{entry.File, entry.Template, entry.Node, entry.Type}] += max(entry.Count, 1)
+	}
+	return b, nil
+}
+
+func writeBaseline(path string, b baseline) error {
+	file := baselineFile{Errors: b.entries()}
+	if file.Errors == nil {
+		file.Errors = []baselineEntry{}
+	}
+	buf, err := json.MarshalIndent(file, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(buf, '\n'), 0o644)
+}
+
+// writeFixed reports the baselined failures that no longer occur, so the
+// baseline can be rewritten to stop tolerating them.
+func writeFixed(stderr io.Writer, path string, b baseline) {
+	fixed := 0
+	for _, entry := range b.entries() {
+		fixed += entry.Count
+		_, _ = fmt.Fprintf(stderr, "%s: fixed: executing %q at <%s>: %s", entry.File, entry.Template, entry.Node, entry.Type)
+		if entry.Count > 1 {
+			_, _ = fmt.Fprintf(stderr, " (%d times)", entry.Count)
+		}
+		_, _ = fmt.Fprintln(stderr)
+	}
+	if fixed > 0 {
+		_, _ = fmt.Fprintf(stderr, "%d baselined failures fixed; update %s with -baseline write\n", fixed, path)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/typelate/check"
+)
+
+// configFileName is the project configuration file, looked for in the
+// working directory and each directory above it.
+const configFileName = "check-templates.json"
+
+// projectConfig is a checked-in check-templates.json. Flags given on the
+// command line take precedence over it.
+type projectConfig struct {
+	// Packages are the package patterns checked when none are given as
+	// arguments, relative to the directory holding the file.
+	Packages []string `json:"packages"`
+
+	// Tags are the build tags packages are loaded with.
+	Tags []string `json:"tags"`
+
+	// Renderers are functions or methods, besides ExecuteTemplate, whose
+	// calls execute a template by name.
+	Renderers []rendererConfig `json:"renderers"`
+
+	// FuncMaps name the functions or variables providing a template.FuncMap
+	// passed to Funcs, as "package/path.Name".
+	FuncMaps []string `json:"funcMaps"`
+
+	// Severity overrides the severity of an error type, keyed by its slug:
+	// "error", "warning", or "off" to drop the errors entirely.
+	Severity map[string]string `json:"severity"`
+
+	// Exclude lists path.Match patterns for templates whose errors are
+	// dropped, matched against the template's file relative to the
+	// directory holding the config and against the template name.
+	Exclude []string `json:"exclude"`
+
+	// Output is the default output format, tsv or jsonl.
+	Output string `json:"output"`
+
+	// dir is the directory holding the file.
+	dir string
+}
+
+type rendererConfig struct {
+	Func      string `json:"func"`
+	Templates string `json:"templates"`
+	NameArg   int    `json:"nameArg"`
+	DataArg   int    `json:"dataArg"`
+}
+
+// findConfig reads the first check-templates.json found walking up from
+// dir. It returns a zero config, with no directory, when there is none.
+func findConfig(dir string) (projectConfig, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return projectConfig{}, err
+	}
+	for {
+		filename := filepath.Join(dir, configFileName)
+		buf, err := os.ReadFile(filename)
+		switch {
+		case err == nil:
+			return readConfig(filename, buf)
+		case !errors.Is(err, fs.ErrNotExist):
+			return projectConfig{}, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return projectConfig{}, nil
+		}
+		dir = parent
+	}
+}
+
+func readConfig(filename string, buf []byte) (projectConfig, error) {
+	var config projectConfig
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return projectConfig{}, fmt.Errorf("%s: %w", filename, err)
+	}
+	for slug, severity := range config.Severity {
+		switch severity {
+		case "error", "warning", "off":
+		default:
+			return projectConfig{}, fmt.Errorf("%s: unsupported severity %q for %s", filename, severity, slug)
+		}
+	}
+	for _, pattern := range config.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return projectConfig{}, fmt.Errorf("%s: exclude pattern %q: %w", filename, pattern, err)
+		}
+	}
+	config.dir = filepath.Dir(filename)
+	return config, nil
+}
+
+// renderers converts the configured renderers for check.PackageConfig.
+func (config projectConfig) renderers() []check.Renderer {
+	var renderers []check.Renderer
+	for _, r := range config.Renderers {
+		renderers = append(renderers, check.Renderer{
+			Func:      r.Func,
+			Templates: r.Templates,
+			NameArg:   r.NameArg,
+			DataArg:   r.DataArg,
+		})
+	}
+	return renderers
+}
+
+// adjust applies the configured severities to the failures in err.
+func (config projectConfig) adjust(err error) {
+	root, ok := errors.AsType[*check.Error](err)
+	if !ok || len(config.Severity) == 0 {
+		return
+	}
+	for e := range root.All {
+		switch config.Severity[e.Type.String()] {
+		case "error":
+			e.Severity = check.SeverityError
+		case "warning":
+			e.Severity = check.SeverityWarning
+		}
+	}
+}
+
+// dropped reports whether the config turns off e's type or excludes the
+// template it is in.
+func (config projectConfig) dropped(e *check.Error) bool {
+	if config.Severity[e.Type.String()] == "off" {
+		return true
+	}
+	if len(config.Exclude) == 0 || e.Tree == nil {
+		return false
+	}
+	file := e.Tree.ParseName
+	if rel, err := filepath.Rel(config.dir, file); err == nil && filepath.IsAbs(file) {
+		file = filepath.ToSlash(rel)
+	}
+	for _, pattern := range config.Exclude {
+		if match, _ := path.Match(pattern, file); match {
+			return true
+		}
+		if match, _ := path.Match(pattern, e.Tree.Name); match {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/typelate/check"
+)
+
+// appendFixes appends the text edits suggested by every failure in err.
+func appendFixes(fixes []check.TextEdit, err error) []check.TextEdit {
+	root, ok := errors.AsType[*check.Error](err)
+	if !ok {
+		return fixes
+	}
+	for e := range root.All {
+		fixes = append(fixes, e.Fixes...)
+	}
+	return fixes
+}
+
+// applyFixes rewrites each .gohtml file the edits target. Templates read
+// from files are named by absolute path; a relative name belongs to a
+// template parsed from a Go string and is left alone. A template checked
+// from several ExecuteTemplate calls suggests the same edit more than once,
+// so duplicates are applied once; an edit overlapping one already applied
+// is skipped.
+func applyFixes(fixes []check.TextEdit) error {
+	byFile := make(map[string][]check.TextEdit)
+	for _, edit := range fixes {
+		if !filepath.IsAbs(edit.Filename) || filepath.Ext(edit.Filename) != ".gohtml" || slices.Contains(byFile[edit.Filename], edit) {
+			continue
+		}
+		byFile[edit.Filename] = append(byFile[edit.Filename], edit)
+	}
+	for _, filename := range slices.Sorted(maps.Keys(byFile)) {
+		if err := applyFileFixes(filename, byFile[filename]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyFileFixes(filename string, edits []check.TextEdit) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	// Apply from the end of the file so earlier offsets stay valid.
+	slices.SortFunc(edits, func(a, b check.TextEdit) int {
+		return cmp.Or(cmp.Compare(b.Pos, a.Pos), cmp.Compare(b.End, a.End))
+	})
+	limit := len(src)
+	for _, edit := range edits {
+		if edit.Pos < 0 || edit.Pos > edit.End || edit.End > limit {
+			continue
+		}
+		src = slices.Concat(src[:edit.Pos], []byte(edit.NewText), src[edit.End:])
+		limit = edit.Pos
+	}
+	if err := os.WriteFile(filename, src, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("writing %s: %w", filename, err)
+	}
+	return nil
+}
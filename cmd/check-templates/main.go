@@ -11,7 +11,8 @@ import (
 	"io"
 	"log"
 	"os"
-	"strconv"
+	"path/filepath"
+	"slices"
 	"strings"
 	"text/template/parse"
 
@@ -31,32 +32,120 @@ func main() {
 func run(dir string, args []string, stdout, stderr io.Writer) int {
 	var (
 		verbose      bool
+		lenient      bool
+		nilPointers  bool
+		deprecations bool
+		fix          bool
 		outputFormat string
+		baselineMode string
+		tags         string
+		tests        bool
+		env          envFlag
+		overlayPath  string
 	)
 
 	flagSet := flag.NewFlagSet("check-templates", flag.ContinueOnError)
 	flagSet.BoolVar(&verbose, "v", false, "show all calls")
 	flagSet.StringVar(&dir, "C", dir, "change directory")
 	flagSet.StringVar(&outputFormat, "o", "tsv", "output format: tsv or jsonl")
+	flagSet.BoolVar(&lenient, "lenient", false, "permit field access through interface values and report it as unchecked")
+	flagSet.BoolVar(&nilPointers, "nil-pointers", false, "report field access through pointers not guarded by with or if")
+	flagSet.BoolVar(&deprecations, "deprecated", true, "warn about deprecated fields and methods")
+	flagSet.BoolVar(&fix, "fix", false, "apply suggested fixes to .gohtml template files in place")
+	flagSet.StringVar(&baselineMode, "baseline", "", "write or check the baseline file given as the first argument")
+	flagSet.StringVar(&tags, "tags", "", "comma-separated build tags to load packages with")
+	flagSet.BoolVar(&tests, "test", false, "also check calls in _test.go files")
+	flagSet.StringVar(&overlayPath, "overlay", "", "read Go and template files through a go build -overlay JSON file")
+	flagSet.Var(&env, "env", "set an environment variable, such as GOOS=windows, when loading packages; may be repeated")
 	if err := flagSet.Parse(args); err != nil {
 		_, _ = fmt.Fprintln(stderr, err)
 		return 1
 	}
 
+	project, err := findConfig(dir)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "failed to read config: %v\n", err)
+		return 1
+	}
+	if project.Output != "" && !isFlagSet(flagSet, "o") {
+		outputFormat = project.Output
+	}
+
 	switch outputFormat {
 	case "tsv", "jsonl":
 	default:
 		_, _ = fmt.Fprintf(stderr, "unsupported output format: %s\n", outputFormat)
 		return 1
 	}
+	writeUnchecked := writeUncheckedFunc(outputFormat, stdout)
+	writeFailure := writeFailureFunc(outputFormat, stdout)
 	if !verbose {
 		stdout = io.Discard
 	}
 	writeCall := writeCallFunc(outputFormat, stdout)
+	writeUnresolved := writeUnresolvedFunc(outputFormat, stdout)
 
-	loadArgs := []string{"."}
-	if args := flagSet.Args(); len(args) > 0 {
-		loadArgs = flagSet.Args()
+	args = flagSet.Args()
+	var (
+		baselinePath string
+		known        baseline
+		inBaseline   func(*check.Error) bool
+	)
+	switch baselineMode {
+	case "":
+	case "write", "check":
+		if len(args) == 0 {
+			_, _ = fmt.Fprintf(stderr, "-baseline %s requires a baseline file argument\n", baselineMode)
+			return 1
+		}
+		baselinePath, args = args[0], args[1:]
+		if !filepath.IsAbs(baselinePath) {
+			baselinePath = filepath.Join(dir, baselinePath)
+		}
+		known = make(baseline)
+		if baselineMode == "check" {
+			var err error
+			if known, err = readBaseline(baselinePath); err != nil {
+				_, _ = fmt.Fprintf(stderr, "failed to read baseline: %v\n", err)
+				return 1
+			}
+			inBaseline = known.consumeFunc(dir)
+		}
+	default:
+		_, _ = fmt.Fprintf(stderr, "unsupported baseline mode: %s\n", baselineMode)
+		return 1
+	}
+
+	loadArgs, loadDir := []string{"."}, dir
+	if len(args) > 0 {
+		loadArgs = args
+	} else if len(project.Packages) > 0 {
+		loadArgs, loadDir = project.Packages, project.dir
+	}
+	if !isFlagSet(flagSet, "tags") {
+		tags = strings.Join(project.Tags, ",")
+	}
+	var buildFlags []string
+	if tags != "" {
+		buildFlags = []string{"-tags=" + tags}
+	}
+	var overlay map[string][]byte
+	if overlayPath != "" {
+		if fix {
+			_, _ = fmt.Fprintln(stderr, "-fix cannot be used with -overlay")
+			return 1
+		}
+		if overlay, err = readOverlay(dir, absolutePath(dir, overlayPath)); err != nil {
+			_, _ = fmt.Fprintf(stderr, "failed to read overlay: %v\n", err)
+			return 1
+		}
+	}
+	var loadEnv []string
+	if len(env) > 0 {
+		loadEnv = append(os.Environ(), env...)
+	}
+	skip := func(e *check.Error) bool {
+		return project.dropped(e) || (inBaseline != nil && inBaseline(e))
 	}
 
 	fset := token.NewFileSet()
@@ -70,13 +159,64 @@ func run(dir string, args []string, stdout, stderr io.Writer) int {
 		Mode: packages.NeedTypesInfo | packages.NeedName | packages.NeedFiles |
 			packages.NeedTypes | packages.NeedSyntax | packages.NeedEmbedPatterns |
 			packages.NeedEmbedFiles | packages.NeedImports | packages.NeedModule |
-			packages.NeedDeps,
-		Dir: dir,
+			packages.NeedDeps | packages.NeedForTest,
+		Dir:        loadDir,
+		BuildFlags: buildFlags,
+		Env:        loadEnv,
+		Tests:      tests,
+		Overlay:    overlay,
 	}, loadArgs...)
 	if err != nil {
 		_, _ = fmt.Fprintf(stderr, "failed to load packages: %v\n", err)
 		return 1
 	}
+	pkgs = withoutDuplicateVariants(pkgs)
+
+	packageConfig := func() check.PackageConfig {
+		sources := make(map[*parse.Tree]string)
+		return check.PackageConfig{
+			InspectCall: func(node *ast.CallExpr, t *parse.Tree, tp types.Type) {
+				writeCall(fset.Position(node.Pos()), t.Name, tp)
+			},
+			InspectTemplate: func(node *parse.TemplateNode, t *parse.Tree, tp types.Type) {
+				start, _ := check.NodeRange(sources, t, node)
+				writeCall(start, t.Name, tp)
+			},
+			InspectUnresolved: func(node *ast.CallExpr) {
+				writeUnresolved(fset.Position(node.Pos()), types.ExprString(node.Fun))
+			},
+			Lenient: lenient,
+			InspectUnchecked: func(node parse.Node, t *parse.Tree, tp types.Type) {
+				start, _ := check.NodeRange(sources, t, node)
+				writeUnchecked(start, node.String(), tp)
+			},
+			NilPointers:  nilPointers,
+			Deprecations: deprecations,
+			Renderers:    project.renderers(),
+			FuncMaps:     project.FuncMaps,
+			Overlay:      overlay,
+			Sources:      sources,
+		}
+	}
+
+	if fix {
+		// Apply the suggested edits before the checks reported below, so
+		// the failures written and the exit code are those left after
+		// fixing. Template files are read as each check runs, so the
+		// loaded packages are checked again as they are.
+		var fixes []check.TextEdit
+		for _, pkg := range pkgs {
+			config := packageConfig()
+			config.InspectCall, config.InspectTemplate, config.InspectUnchecked, config.InspectUnresolved = nil, nil, nil, nil
+			if err := config.Check(pkg); err != nil {
+				fixes = appendFixes(fixes, err)
+			}
+		}
+		if err := applyFixes(fixes); err != nil {
+			_, _ = fmt.Fprintf(stderr, "failed to apply fixes: %v\n", err)
+			return 1
+		}
+	}
 
 	exitCode := 0
 	for _, pkg := range pkgs {
@@ -84,15 +224,24 @@ func run(dir string, args []string, stdout, stderr io.Writer) int {
 			_, _ = fmt.Fprintln(stderr, e)
 			exitCode = 1
 		}
-		if err := check.Package(pkg, func(node *ast.CallExpr, t *parse.Tree, tp types.Type) {
-			writeCall(fset.Position(node.Pos()), t.Name, tp)
-		}, func(node *parse.TemplateNode, t *parse.Tree, tp types.Type) {
-			loc, _ := t.ErrorContext(node)
-			writeCall(parseLocation(loc), t.Name, tp)
-		}); err != nil {
-			writeCheckError(stderr, err)
-			exitCode = 1
+		config := packageConfig()
+		if err := config.Check(pkg); err != nil {
+			project.adjust(err)
+			if baselineMode == "write" {
+				known.add(dir, err, project.dropped)
+			} else if writeCheckError(stderr, err, skip, writeFailure) {
+				exitCode = 1
+			}
+		}
+	}
+	switch baselineMode {
+	case "write":
+		if err := writeBaseline(baselinePath, known); err != nil {
+			_, _ = fmt.Fprintf(stderr, "failed to write baseline: %v\n", err)
+			return 1
 		}
+	case "check":
+		writeFixed(stderr, baselinePath, known)
 	}
 	return exitCode
 }
@@ -101,24 +250,32 @@ func run(dir string, args []string, stdout, stderr io.Writer) int {
 // line per failure first, so the full set of problems can be scanned at a
 // glance, followed by each distinct supporting detail block (type
 // declarations, signatures) exactly once, no matter how many failures
-// reference it.
-func writeCheckError(stderr io.Writer, err error) {
+// reference it. Failures skip reports are left out; each one written is
+// also passed to record. It reports whether any failure written is an
+// error rather than a warning.
+func writeCheckError(stderr io.Writer, err error, skip func(*check.Error) bool, record func(*check.Error)) bool {
 	root, ok := errors.AsType[*check.Error](err)
 	if !ok {
 		_, _ = fmt.Fprintln(stderr, check.FormatVerbose(err))
-		return
+		return true
 	}
+	failed := false
 	var details []string
 	seen := make(map[string]bool)
 	for e := range root.All {
-		if e.Type == check.ErrorTypeAggregate {
+		if e.Type == check.ErrorTypeAggregate || skip(e) {
 			continue
 		}
+		failed = failed || e.Severity == check.SeverityError
 		line, detail := splitVerbose(e)
+		if len(e.Suggestions) > 0 {
+			line += fmt.Sprintf(" (did you mean %s?)", strings.Join(e.Suggestions, ", "))
+		}
 		if e.Decl.IsValid() {
 			line += fmt.Sprintf(" (declared at %s)", e.Decl)
 		}
 		_, _ = fmt.Fprintln(stderr, line)
+		record(e)
 		if detail != "" && !seen[detail] && !redundantDetail(detail) {
 			seen[detail] = true
 			details = append(details, detail)
@@ -127,6 +284,47 @@ func writeCheckError(stderr io.Writer, err error) {
 	for _, detail := range details {
 		_, _ = fmt.Fprintf(stderr, "\n%s\n", detail)
 	}
+	return failed
+}
+
+// withoutDuplicateVariants drops the packages loading with tests adds
+// that would be checked twice: a package whose test variant, which
+// compiles the same files plus its _test.go files, was loaded too, and
+// the generated test main packages.
+func withoutDuplicateVariants(pkgs []*packages.Package) []*packages.Package {
+	hasTestVariant := make(map[string]bool)
+	for _, pkg := range pkgs {
+		if pkg.ForTest != "" && pkg.PkgPath == pkg.ForTest {
+			hasTestVariant[pkg.PkgPath] = true
+		}
+	}
+	return slices.DeleteFunc(pkgs, func(pkg *packages.Package) bool {
+		testMain := pkg.ForTest == "" && pkg.Name == "main" && strings.HasSuffix(pkg.ID, ".test")
+		return testMain || (pkg.ForTest == "" && hasTestVariant[pkg.PkgPath])
+	})
+}
+
+// envFlag collects the KEY=VALUE pairs of a repeated flag.
+type envFlag []string
+
+func (env *envFlag) String() string { return strings.Join(*env, " ") }
+
+func (env *envFlag) Set(value string) error {
+	if key, _, ok := strings.Cut(value, "="); !ok || key == "" {
+		return fmt.Errorf("expected KEY=VALUE, got %q", value)
+	}
+	*env = append(*env, value)
+	return nil
+}
+
+// isFlagSet reports whether the flag named name was given on the command
+// line, rather than left at its default.
+func isFlagSet(flagSet *flag.FlagSet, name string) bool {
+	set := false
+	flagSet.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
 }
 
 // redundantDetail reports whether a detail block only restates the type
@@ -183,19 +381,119 @@ func writeCallFunc(outputFormat string, stdout io.Writer) func(pos token.Positio
 	}
 }
 
-// parseLocation parses a "filename:line:col" string into a token.Position.
-func parseLocation(loc string) token.Position {
-	// ErrorContext returns "filename:line:col" format.
-	// The filename may contain colons (e.g., Windows paths), so split from the right.
-	var pos token.Position
-	if i := strings.LastIndex(loc, ":"); i >= 0 {
-		pos.Column, _ = strconv.Atoi(loc[i+1:])
-		loc = loc[:i]
+// uncheckedRecord reports a node the -lenient flag let through without
+// checking because it selects from an interface value.
+type uncheckedRecord struct {
+	Filename  string `json:"filename"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	Offset    int    `json:"offset"`
+	Unchecked string `json:"unchecked"`
+	DataType  string `json:"data_type"`
+}
+
+func writeUncheckedFunc(outputFormat string, stdout io.Writer) func(pos token.Position, node string, dataType types.Type) {
+	switch outputFormat {
+	case "jsonl":
+		enc := json.NewEncoder(stdout)
+		return func(pos token.Position, node string, dataType types.Type) {
+			_ = enc.Encode(uncheckedRecord{
+				Filename:  pos.Filename,
+				Line:      pos.Line,
+				Column:    pos.Column,
+				Offset:    pos.Offset,
+				Unchecked: node,
+				DataType:  dataType.String(),
+			})
+		}
+	default:
+		return func(pos token.Position, node string, dataType types.Type) {
+			_, _ = fmt.Fprintf(stdout, "%s\tunchecked\t%s\t%s\n", pos, node, dataType)
+		}
 	}
-	if i := strings.LastIndex(loc, ":"); i >= 0 {
-		pos.Line, _ = strconv.Atoi(loc[i+1:])
-		loc = loc[:i]
+}
+
+// unresolvedRecord reports an ExecuteTemplate call left unchecked because
+// the templates its receiver holds could not be resolved.
+type unresolvedRecord struct {
+	Filename   string `json:"filename"`
+	Line       int    `json:"line"`
+	Column     int    `json:"column"`
+	Offset     int    `json:"offset"`
+	Unresolved string `json:"unresolved"`
+}
+
+func writeUnresolvedFunc(outputFormat string, stdout io.Writer) func(pos token.Position, fun string) {
+	switch outputFormat {
+	case "jsonl":
+		enc := json.NewEncoder(stdout)
+		return func(pos token.Position, fun string) {
+			_ = enc.Encode(unresolvedRecord{
+				Filename:   pos.Filename,
+				Line:       pos.Line,
+				Column:     pos.Column,
+				Offset:     pos.Offset,
+				Unresolved: fun,
+			})
+		}
+	default:
+		return func(pos token.Position, fun string) {
+			_, _ = fmt.Fprintf(stdout, "%s\tunresolved\t%s\n", pos, fun)
+		}
+	}
+}
+
+// failureRecord reports a check failure with the range of template or Go
+// source it covers, for tools such as CI annotators. Columns count bytes
+// from 1 and the end is exclusive.
+type failureRecord struct {
+	Filename     string   `json:"filename"`
+	Line         int      `json:"line"`
+	Column       int      `json:"column"`
+	Offset       int      `json:"offset"`
+	EndLine      int      `json:"end_line"`
+	EndColumn    int      `json:"end_column"`
+	EndOffset    int      `json:"end_offset"`
+	TemplateName string   `json:"template_name,omitempty"`
+	Type         string   `json:"type"`
+	Severity     string   `json:"severity"`
+	Message      string   `json:"message"`
+	Suggestions  []string `json:"suggestions,omitempty"`
+	Declared     string   `json:"declared,omitempty"`
+}
+
+// writeFailureFunc returns the function recording each failure written to
+// stderr. Only jsonl output records them, on stdout whether or not -v is
+// set; the tsv form is the stderr line itself.
+func writeFailureFunc(outputFormat string, stdout io.Writer) func(e *check.Error) {
+	switch outputFormat {
+	case "jsonl":
+		enc := json.NewEncoder(stdout)
+		return func(e *check.Error) {
+			record := failureRecord{
+				Filename:    e.Start.Filename,
+				Line:        e.Start.Line,
+				Column:      e.Start.Column,
+				Offset:      e.Start.Offset,
+				EndLine:     e.End.Line,
+				EndColumn:   e.End.Column,
+				EndOffset:   e.End.Offset,
+				Type:        e.Type.String(),
+				Severity:    e.Severity.String(),
+				Suggestions: e.Suggestions,
+			}
+			if cause := errors.Join(e.Unwrap()...); cause != nil {
+				record.Message = cause.Error()
+			}
+			if e.Tree != nil {
+				record.TemplateName = e.Tree.Name
+			}
+			if e.Decl.IsValid() {
+				record.Declared = e.Decl.String()
+			}
+			_ = enc.Encode(record)
+		}
+	default:
+		return func(*check.Error) {}
 	}
-	pos.Filename = loc
-	return pos
 }
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// overlayFile is the JSON form of go build -overlay: each key names a file
+// whose contents are read from the file its value names instead.
+type overlayFile struct {
+	Replace map[string]string
+}
+
+// readOverlay reads a go build -overlay file into the absolute path to
+// contents map packages.Config.Overlay and check.PackageConfig.Overlay
+// take. Relative paths are relative to dir.
+func readOverlay(dir, filename string) (map[string][]byte, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var file overlayFile
+	if err := json.Unmarshal(buf, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	overlay := make(map[string][]byte, len(file.Replace))
+	for target, replacement := range file.Replace {
+		if replacement == "" {
+			return nil, fmt.Errorf("%s: deleting %s is not supported", filename, target)
+		}
+		contents, err := os.ReadFile(absolutePath(dir, replacement))
+		if err != nil {
+			return nil, err
+		}
+		overlay[absolutePath(dir, target)] = contents
+	}
+	return overlay, nil
+}
+
+func absolutePath(dir, filename string) string {
+	if filepath.IsAbs(filename) {
+		return filepath.Clean(filename)
+	}
+	return filepath.Join(dir, filename)
+}
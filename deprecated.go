@@ -0,0 +1,136 @@
+package check
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"text/template/parse"
+
+	"golang.org/x/tools/go/packages"
+
+	"github.com/typelate/check/internal/asteval"
+)
+
+// checkDeprecated reports a warning when obj, the field or method ident
+// resolved to on x, is documented as deprecated.
+func (s *scope) checkDeprecated(tree *parse.Tree, n parse.Node, x types.Type, ident string, at span, obj types.Object) {
+	notice, ok := s.global.deprecation(obj)
+	if !ok {
+		return
+	}
+	e := newError(ErrorTypeDeprecated, tree, n, "%s.%s is deprecated: %s", x, ident, notice).
+		withX(x).
+		withDecl(s.global.fileSet.Position(obj.Pos())).
+		withSpan(at)
+	e.Severity = SeverityWarning
+	s.report(e)
+}
+
+// docComments holds the doc comments deprecation notices are read from.
+// PackageConfig.Check shares one between the Globals checking a package,
+// so each Go file is parsed at most once.
+type docComments struct {
+	notices map[types.Object]string
+	files   map[string]docFile
+}
+
+// docFile is a parsed Go file and the file set its positions are in.
+type docFile struct {
+	file    *ast.File
+	fileSet *token.FileSet
+}
+
+// packageDocComments seeds a docComments with the syntax of pkg and the
+// packages it imports, which the loader has already parsed with any
+// overlay applied.
+func packageDocComments(pkg *packages.Package) *docComments {
+	docs := &docComments{files: make(map[string]docFile)}
+	packages.Visit([]*packages.Package{pkg}, nil, func(p *packages.Package) {
+		for _, file := range p.Syntax {
+			if tf := p.Fset.File(file.Pos()); tf != nil {
+				docs.files[tf.Name()] = docFile{file: file, fileSet: p.Fset}
+			}
+		}
+	})
+	return docs
+}
+
+// deprecation returns the text of the "Deprecated: " paragraph in the doc
+// comment of obj. The comment is read from obj's source file, which is
+// parsed at most once unless the package syntax already holds it; objects
+// whose source is not available are never deprecated.
+func (g *Global) deprecation(obj types.Object) (string, bool) {
+	if g.docs == nil {
+		g.docs = &docComments{files: make(map[string]docFile)}
+	}
+	if notice, ok := g.docs.notices[obj]; ok {
+		return notice, notice != ""
+	}
+	if g.docs.notices == nil {
+		g.docs.notices = make(map[types.Object]string)
+	}
+	var notice string
+	if pos := g.fileSet.Position(obj.Pos()); pos.IsValid() && pos.Filename != "" {
+		notice = deprecationNotice(g.docComment(pos))
+	}
+	g.docs.notices[obj] = notice
+	return notice, notice != ""
+}
+
+// docComment finds the doc comment of the field, method, or interface
+// method whose name is declared at pos.
+func (g *Global) docComment(pos token.Position) *ast.CommentGroup {
+	df, ok := g.docs.files[pos.Filename]
+	if !ok {
+		df.fileSet = token.NewFileSet()
+		if src, err := asteval.ReadFile(g.Overlay, pos.Filename); err == nil {
+			df.file, _ = parser.ParseFile(df.fileSet, pos.Filename, src, parser.ParseComments|parser.SkipObjectResolution)
+		}
+		g.docs.files[pos.Filename] = df
+	}
+	if df.file == nil {
+		return nil
+	}
+	declaredAt := func(name *ast.Ident) bool {
+		return df.fileSet.Position(name.Pos()).Offset == pos.Offset
+	}
+	var doc *ast.CommentGroup
+	ast.Inspect(df.file, func(node ast.Node) bool {
+		if doc != nil {
+			return false
+		}
+		switch n := node.(type) {
+		case *ast.FuncDecl:
+			if declaredAt(n.Name) {
+				doc = n.Doc
+				return false
+			}
+		case *ast.Field:
+			for _, name := range n.Names {
+				if declaredAt(name) {
+					doc = n.Doc
+					return false
+				}
+			}
+		}
+		return true
+	})
+	return doc
+}
+
+// deprecationNotice returns the paragraph of doc that starts with
+// "Deprecated: ", without the prefix and joined onto one line, following
+// the convention go doc and staticcheck recognize.
+func deprecationNotice(doc *ast.CommentGroup) string {
+	if doc == nil {
+		return ""
+	}
+	for paragraph := range strings.SplitSeq(doc.Text(), "\n\n") {
+		if notice, ok := strings.CutPrefix(paragraph, "Deprecated: "); ok {
+			return strings.Join(strings.Fields(notice), " ")
+		}
+	}
+	return ""
+}
@@ -21,7 +21,8 @@ const maxInlineTypeLength = 64
 // an indented Go-style declaration — exported fields (private fields are
 // noted but omitted) followed by exported methods as func declarations that
 // keep the declared receiver, so pointer receivers stay visible; call
-// failures show the callee signature and the argument types.
+// failures show the callee signature and the argument types. A failure
+// with Suggestions adds a "did you mean" line before that detail.
 //
 // Every line — including the leading location line — prints type names with
 // types.WriteType using q, so a caller can qualify packages for the target
@@ -57,6 +58,10 @@ func (e *Error) writeDetail(sw *stickyWriter, q types.Qualifier, tf typeFormatFu
 		return
 	}
 	sw.writeString(e.line(tf))
+	if len(e.Suggestions) > 0 {
+		sw.writeString("\n\n")
+		sw.writeString(formatSuggestions(e.Suggestions))
+	}
 	if identErr, ok := errors.AsType[*IdentifierError](e.err); ok && identErr.Type != nil {
 		sw.writeString("\n\n")
 		writeTypeDecl(sw, identErr.Type, declTypeFormat(identErr.Type, q, tf))
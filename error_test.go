@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"go/token"
 	"go/types"
+	"maps"
+	"slices"
 	"strings"
 	"testing"
 	"text/template"
@@ -482,6 +484,218 @@ func TestError_Decl(t *testing.T) {
 	require.Equal(t, fset.Position(declPos), leaf.Decl)
 }
 
+// treeList is a TreeFinder that can also list its trees.
+type treeList map[string]*parse.Tree
+
+func (l treeList) FindTree(name string) (*parse.Tree, bool) {
+	tree, ok := l[name]
+	return tree, ok
+}
+
+func (l treeList) TreeNames() []string {
+	return slices.Sorted(maps.Keys(l))
+}
+
+func TestError_Suggestions(t *testing.T) {
+	pkg := types.NewPackage("example.com/web", "web")
+	page := types.NewNamed(types.NewTypeName(token.NoPos, pkg, "Page", nil), types.NewStruct([]*types.Var{
+		types.NewField(token.NoPos, pkg, "Title", types.Typ[types.String], false),
+		types.NewField(token.NoPos, pkg, "Name", types.Typ[types.String], false),
+		types.NewField(token.NoPos, pkg, "Names", types.NewSlice(types.Typ[types.String]), false),
+	}, nil), nil)
+	page.AddMethod(types.NewFunc(token.NoPos, pkg, "URL", types.NewSignatureType(
+		types.NewVar(token.NoPos, pkg, "p", page), nil, nil, nil,
+		types.NewTuple(types.NewVar(token.NoPos, pkg, "", types.Typ[types.String])), false)))
+	functions := check.Functions{
+		"upper": types.NewSignatureType(nil, nil, nil,
+			types.NewTuple(types.NewVar(token.NoPos, pkg, "", types.Typ[types.String])),
+			types.NewTuple(types.NewVar(token.NoPos, pkg, "", types.Typ[types.String])), false),
+	}
+
+	for _, tt := range []struct {
+		Name, Template string
+		Suggestions    []string
+	}{
+		{Name: "transposed field", Template: `{{.Titel}}`, Suggestions: []string{"Title"}},
+		{Name: "field case", Template: `{{.Url}}`, Suggestions: []string{"URL"}},
+		{Name: "unexported field", Template: `{{.name}}`, Suggestions: []string{"Name", "Names"}},
+		{Name: "ties by name", Template: `{{.Namez}}`, Suggestions: []string{"Name", "Names"}},
+		{Name: "nothing close", Template: `{{.Description}}`},
+		{Name: "function", Template: `{{uppr .Title}}`, Suggestions: []string{"upper"}},
+		{Name: "built-in function", Template: `{{lenn .Title}}`, Suggestions: []string{"len"}},
+		{Name: "template", Template: `{{template "heder" .}}`, Suggestions: []string{"header"}},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			tree := parse.New("page.gohtml")
+			tree.Mode = parse.SkipFuncCheck
+			trees := make(map[string]*parse.Tree)
+			_, err := tree.Parse(tt.Template+`{{define "header"}}{{end}}`, "", "", trees)
+			require.NoError(t, err)
+			global := check.NewGlobal(pkg, token.NewFileSet(), treeList(trees), functions)
+
+			leaf := findLeafError(t, check.Execute(global, trees["page.gohtml"], page))
+			require.Equal(t, tt.Suggestions, leaf.Suggestions)
+
+			var detailed strings.Builder
+			require.NoError(t, leaf.DetailedError(&detailed, nil))
+			if len(tt.Suggestions) > 0 {
+				require.Contains(t, detailed.String(), "\n\ndid you mean "+strings.Join(tt.Suggestions, ", ")+"?")
+			} else {
+				require.NotContains(t, detailed.String(), "did you mean")
+			}
+		})
+	}
+}
+
+func TestError_Fixes(t *testing.T) {
+	pkg := types.NewPackage("example.com/web", "web")
+	stringResult := types.NewTuple(types.NewVar(token.NoPos, pkg, "", types.Typ[types.String]))
+	user := types.NewNamed(types.NewTypeName(token.NoPos, pkg, "User", nil), types.NewStruct([]*types.Var{
+		types.NewField(token.NoPos, pkg, "URL", types.Typ[types.String], false),
+		types.NewField(token.NoPos, pkg, "ID", types.Typ[types.Int], false),
+		types.NewField(token.NoPos, pkg, "Id", types.Typ[types.Int], false),
+	}, nil), nil)
+	page := types.NewNamed(types.NewTypeName(token.NoPos, pkg, "Page", nil), types.NewStruct([]*types.Var{
+		types.NewField(token.NoPos, pkg, "Title", types.Typ[types.String], false),
+		types.NewField(token.NoPos, pkg, "User", user, false),
+		types.NewField(token.NoPos, pkg, "Format", types.NewSignatureType(nil, nil, nil,
+			types.NewTuple(types.NewVar(token.NoPos, pkg, "", types.Typ[types.String])), stringResult, false), false),
+		types.NewField(token.NoPos, pkg, "Status", types.NewMap(types.Typ[types.Int], types.Typ[types.String]), false),
+		types.NewField(token.NoPos, pkg, "Flags", types.NewMap(types.Typ[types.Bool], types.Typ[types.String]), false),
+	}, nil), nil)
+	page.AddMethod(types.NewFunc(token.NoPos, pkg, "Greet", types.NewSignatureType(
+		types.NewVar(token.NoPos, pkg, "p", page), nil, nil,
+		types.NewTuple(
+			types.NewVar(token.NoPos, pkg, "name", types.Typ[types.String]),
+			types.NewVar(token.NoPos, pkg, "n", types.Typ[types.Int]),
+			types.NewVar(token.NoPos, pkg, "u", types.NewPointer(user)),
+			types.NewVar(token.NoPos, pkg, "rest", types.NewSlice(types.Typ[types.Bool])),
+		), stringResult, true)))
+	page.AddMethod(types.NewFunc(token.NoPos, pkg, "Show", types.NewSignatureType(
+		types.NewVar(token.NoPos, pkg, "p", page), nil, nil,
+		types.NewTuple(types.NewVar(token.NoPos, pkg, "u", user)), stringResult, false)))
+
+	for _, tt := range []struct {
+		Name, Template, Fixed string
+	}{
+		{Name: "unexported field case", Template: `<h1>{{.title}}</h1>`, Fixed: `<h1>{{.Title}}</h1>`},
+		{Name: "field case in a chain", Template: "\n{{.User.Url}}", Fixed: "\n{{.User.URL}}"},
+		{Name: "field case on a variable", Template: `{{$u := .User}}{{$u.Url}}`, Fixed: `{{$u := .User}}{{$u.URL}}`},
+		{Name: "field case after a pipeline", Template: `{{(.User).Url}}`, Fixed: `{{(.User).URL}}`},
+		{Name: "ambiguous case", Template: `{{.User.iD}}`},
+		{Name: "method arguments", Template: `{{.Greet}}`, Fixed: `{{.Greet "" 0 nil}}`},
+		{Name: "method arguments without a zero literal", Template: `{{.Show}}`},
+		{Name: "func field with arguments", Template: `{{.Format .Title}}`, Fixed: `{{call .Format .Title}}`},
+		{Name: "func field on a variable", Template: `{{$.Format "x"}}`, Fixed: `{{call $.Format "x"}}`},
+		{Name: "piped func field", Template: `{{.Title | .Format}}`, Fixed: `{{.Title | call .Format}}`},
+		{Name: "quoted integer map key", Template: `{{index .Status "404"}}`, Fixed: `{{index .Status 404}}`},
+		{Name: "quoted bool map key", Template: `{{index .Flags "true"}}`, Fixed: `{{index .Flags true}}`},
+		{Name: "quoted map key that is not a number", Template: `{{index .Status "missing"}}`},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			tmpl, err := template.New("page.gohtml").Parse(tt.Template)
+			require.NoError(t, err)
+			global := check.NewGlobal(pkg, token.NewFileSet(), findTextTemplateTree(tmpl), check.Functions{})
+
+			leaf := findLeafError(t, check.Execute(global, tmpl.Tree, page))
+			if tt.Fixed == "" {
+				require.Empty(t, leaf.Fixes)
+				return
+			}
+			fixed := tt.Template
+			for _, edit := range slices.Backward(leaf.Fixes) {
+				require.Equal(t, "page.gohtml", edit.Filename)
+				fixed = fixed[:edit.Pos] + edit.NewText + fixed[edit.End:]
+			}
+			require.Equal(t, tt.Fixed, fixed)
+		})
+	}
+
+	t.Run("argument to a variable", func(t *testing.T) {
+		tmpl, err := template.New("page.gohtml").Parse(`{{$f := .Format}}{{$f "x"}}`)
+		require.NoError(t, err)
+		global := check.NewGlobal(pkg, token.NewFileSet(), findTextTemplateTree(tmpl), check.Functions{})
+		leaf := findLeafError(t, check.Execute(global, tmpl.Tree, page))
+		require.Equal(t, check.ErrorTypeNotAFunction, leaf.Type)
+		require.ErrorContains(t, leaf, `can't give argument to non-function $f`)
+		require.Empty(t, leaf.Fixes)
+	})
+}
+
+func TestError_Range(t *testing.T) {
+	pkg := types.NewPackage("example.com/web", "web")
+	user := types.NewNamed(types.NewTypeName(token.NoPos, pkg, "User", nil), types.NewStruct([]*types.Var{
+		types.NewField(token.NoPos, pkg, "Name", types.Typ[types.String], false),
+	}, nil), nil)
+	page := types.NewStruct([]*types.Var{
+		types.NewField(token.NoPos, pkg, "User", user, false),
+	}, nil)
+	position := func(line, column, offset int) token.Position {
+		return token.Position{Filename: "range.gohtml", Line: line, Column: column, Offset: offset}
+	}
+
+	for _, tt := range []struct {
+		Name, Template string
+		Start, End     token.Position
+	}{
+		{
+			Name:     "identifier in a field chain",
+			Template: "<p>\n  {{.User.Nmae}}</p>",
+			Start:    position(2, 11, 14), End: position(2, 15, 18),
+		},
+		{
+			Name:     "identifier on a variable",
+			Template: `{{$u := .User}}{{$u.Nmae}}`,
+			Start:    position(1, 21, 20), End: position(1, 25, 24),
+		},
+		{
+			Name:     "whole node",
+			Template: "\n{{template \"missing\" .User}}",
+			Start:    position(2, 12, 12), End: position(2, 27, 27),
+		},
+		{
+			Name:     "range pipeline",
+			Template: `{{range $i, $u := .User}}{{end}}`,
+			Start:    position(1, 9, 8), End: position(1, 24, 23),
+		},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			tree := parse.New("range.gohtml")
+			tree.Mode = parse.SkipFuncCheck
+			trees := make(map[string]*parse.Tree)
+			_, err := tree.Parse(tt.Template, "", "", trees)
+			require.NoError(t, err)
+			global := check.NewGlobal(pkg, token.NewFileSet(), treeList(trees), check.Functions{})
+			global.Sources = map[*parse.Tree]string{trees["range.gohtml"]: tt.Template}
+
+			leaf := findLeafError(t, check.Execute(global, trees["range.gohtml"], page))
+			require.Equal(t, tt.Start, leaf.Start)
+			require.Equal(t, tt.End, leaf.End)
+		})
+	}
+
+	t.Run("nil node", func(t *testing.T) {
+		tree, err := parse.New("range.gohtml").Parse(`{{template "x"}}`, "", "", make(map[string]*parse.Tree))
+		require.NoError(t, err)
+		start, end := check.NodeRange(nil, tree, (*parse.PipeNode)(nil))
+		require.False(t, start.IsValid())
+		require.False(t, end.IsValid())
+	})
+
+	t.Run("without source", func(t *testing.T) {
+		tree := parse.New("range.gohtml")
+		tree.Mode = parse.SkipFuncCheck
+		trees := make(map[string]*parse.Tree)
+		_, err := tree.Parse("<p>\n  {{.User.Nmae}}</p>", "", "", trees)
+		require.NoError(t, err)
+		global := check.NewGlobal(pkg, token.NewFileSet(), treeList(trees), check.Functions{})
+
+		leaf := findLeafError(t, check.Execute(global, trees["range.gohtml"], page))
+		require.Equal(t, token.Position{Filename: "range.gohtml", Offset: 14}, leaf.Start)
+		require.Equal(t, token.Position{Filename: "range.gohtml", Offset: 18}, leaf.End)
+	})
+}
+
 func TestExecute_secondary_errors(t *testing.T) {
 	pkg := types.NewPackage("example.com/web", "web")
 	emptyStruct := types.NewStruct(nil, nil)
@@ -0,0 +1,171 @@
+package check
+
+import (
+	"go/types"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// TextEdit replaces the template source between the byte offsets Pos and
+// End of the file Filename with NewText. Pos equal to End inserts NewText.
+// Filename is the ParseName of the tree the failure was found in, and the
+// offsets index the text that tree was parsed from.
+type TextEdit struct {
+	Filename string
+	Pos, End int
+	NewText  string
+}
+
+// selectorOffsets returns the byte offset where each selected identifier
+// of n starts. text/template positions a chained field or variable node at
+// its second identifier and a chain node at its first field, so the
+// offsets are worked out back from there.
+func selectorOffsets(n parse.Node) []int {
+	var (
+		pos    int
+		fields []string
+	)
+	switch n := n.(type) {
+	case *parse.FieldNode:
+		pos, fields = nodeStart(n), n.Ident
+	case *parse.VariableNode:
+		pos, fields = nodeStart(n)+len(n.Ident[0]), n.Ident[1:]
+	case *parse.ChainNode:
+		pos, fields = int(n.Pos), n.Field
+	default:
+		return nil
+	}
+	offsets := make([]int, len(fields))
+	for i, field := range fields {
+		offsets[i] = pos + 1
+		pos += len(field) + 1
+	}
+	return offsets
+}
+
+// nodeStart returns the byte offset where a field or variable node starts.
+func nodeStart(n parse.Node) int {
+	switch n := n.(type) {
+	case *parse.FieldNode:
+		if len(n.Ident) > 1 {
+			return int(n.Pos) - len(n.Ident[0]) - 1
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 {
+			return int(n.Pos) - len(n.Ident[0])
+		}
+	}
+	return int(n.Position())
+}
+
+// renameFix replaces the i-th selected identifier of n with the one member
+// of tp that matches it ignoring case.
+func renameFix(tree *parse.Tree, n parse.Node, i int, ident string, tp types.Type) []TextEdit {
+	s := identSpan(n, i, ident)
+	if s.end == 0 {
+		return nil
+	}
+	var match string
+	for _, name := range memberNames(tp) {
+		if strings.EqualFold(name, ident) && name != ident {
+			if match != "" {
+				return nil
+			}
+			match = name
+		}
+	}
+	if match == "" {
+		return nil
+	}
+	return []TextEdit{{Filename: tree.ParseName, Pos: s.pos, End: s.end, NewText: match}}
+}
+
+// argumentsFix inserts a placeholder for each parameter of a method called
+// without arguments: the zero value literal for basic types and nil for
+// types that can be nil. There is no fix when a parameter has neither.
+func argumentsFix(tree *parse.Tree, n parse.Node, i int, ident string, sig *types.Signature) []TextEdit {
+	s := identSpan(n, i, ident)
+	if s.end == 0 {
+		return nil
+	}
+	params := sig.Params().Len()
+	if sig.Variadic() {
+		params--
+	}
+	if params == 0 {
+		return nil
+	}
+	var b strings.Builder
+	for p := range params {
+		placeholder, ok := zeroLiteral(sig.Params().At(p).Type())
+		if !ok {
+			return nil
+		}
+		b.WriteString(" ")
+		b.WriteString(placeholder)
+	}
+	return []TextEdit{{Filename: tree.ParseName, Pos: s.end, End: s.end, NewText: b.String()}}
+}
+
+// zeroLiteral returns template source for the zero value of tp.
+func zeroLiteral(tp types.Type) (string, bool) {
+	switch u := tp.Underlying().(type) {
+	case *types.Basic:
+		switch info := u.Info(); {
+		case info&types.IsString != 0:
+			return `""`, true
+		case info&types.IsBoolean != 0:
+			return "false", true
+		case info&types.IsNumeric != 0:
+			return "0", true
+		}
+	case *types.Pointer, *types.Slice, *types.Map, *types.Signature, *types.Chan, *types.Interface:
+		return "nil", true
+	}
+	return "", false
+}
+
+// callFix rewrites a field holding a func, given arguments as if it were a
+// method, into a call of the func with the call built-in.
+func callFix(tree *parse.Tree, n parse.Node) []TextEdit {
+	switch n.(type) {
+	case *parse.FieldNode, *parse.VariableNode:
+		start := nodeStart(n)
+		return []TextEdit{{Filename: tree.ParseName, Pos: start, End: start, NewText: "call "}}
+	}
+	return nil
+}
+
+// indexKeyFix rewrites a quoted map key given to index, as in
+// index .Pages "404", as the number or bool literal the map's key type
+// needs. Keys like these are not identifiers, so index is the only way to
+// write them; the filename is filled in when the error is located.
+func indexKeyFix(n parse.Node, key types.Type) []TextEdit {
+	str, ok := n.(*parse.StringNode)
+	if !ok {
+		return nil
+	}
+	basic, ok := key.Underlying().(*types.Basic)
+	if !ok {
+		return nil
+	}
+	var err error
+	switch info := basic.Info(); {
+	case info&types.IsUnsigned != 0:
+		_, err = strconv.ParseUint(str.Text, 10, 64)
+	case info&types.IsInteger != 0:
+		_, err = strconv.ParseInt(str.Text, 10, 64)
+	case info&types.IsBoolean != 0:
+		if str.Text != "true" && str.Text != "false" {
+			return nil
+		}
+	default:
+		return nil
+	}
+	if err != nil {
+		return nil
+	}
+	s := nodeSpan(str)
+	return []TextEdit{{Pos: s.pos, End: s.end, NewText: str.Text}}
+}
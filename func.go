@@ -2,8 +2,10 @@ package check
 
 import (
 	"errors"
+	"fmt"
 	"go/types"
 	"maps"
+	"math"
 	"text/template/parse"
 )
 
@@ -58,17 +60,24 @@ func (functions Functions) Add(m Functions) Functions {
 func (functions Functions) CheckCall(global *Global, funcIdent string, argNodes []parse.Node, argTypes []types.Type) (types.Type, error) {
 	fn, ok := functions[funcIdent]
 	if !ok {
-		return builtInCheck(global, funcIdent, argNodes, argTypes)
+		tp, err := builtInCheck(global, funcIdent, argNodes, argTypes)
+		if e, ok := err.(*Error); ok && e.Type == ErrorTypeUnknownFunction {
+			e.Suggestions = suggest(funcIdent, functionNames(functions))
+		}
+		return tp, err
 	}
 	if resultLen := fn.Results().Len(); resultLen == 0 {
 		return nil, errorf(ErrorTypeBadSignature, "function %s has no results", funcIdent).withX(fn)
 	} else if resultLen > 2 {
 		return nil, errorf(ErrorTypeBadSignature, "function %s has too many results", funcIdent).withX(fn)
 	}
-	return checkCallArguments(global, funcIdent, fn, argTypes)
+	return checkCallArguments(global, funcIdent, fn, argNodes, argTypes)
 }
 
-func checkCallArguments(global *Global, name string, fn *types.Signature, args []types.Type) (types.Type, error) {
+// checkCallArguments checks args against fn's parameters. argNodes holds
+// the argument nodes written in the template; a value piped into the call
+// has a type but no node.
+func checkCallArguments(global *Global, name string, fn *types.Signature, argNodes []parse.Node, args []types.Type) (types.Type, error) {
 	callErr := func(format string, a ...any) *Error {
 		render := renderer(format, a...)
 		return wrapError(ErrorTypeCallArguments, nil, nil, &CallError{
@@ -96,14 +105,14 @@ func checkCallArguments(global *Global, name string, fn *types.Signature, args [
 	}
 
 	for i := 0; i < expFixed; i++ {
-		if err := checkArgAssignable(global, callErr, i, fn.Params().At(i).Type(), args[i]); err != nil {
+		if err := checkArgAssignable(global, callErr, i, fn.Params().At(i).Type(), argNode(argNodes, i), args[i]); err != nil {
 			return nil, err
 		}
 	}
 	if isVar {
 		elem := fn.Params().At(expNum - 1).Type().(*types.Slice).Elem()
 		for i := expFixed; i < len(args); i++ {
-			if err := checkArgAssignable(global, callErr, i, elem, args[i]); err != nil {
+			if err := checkArgAssignable(global, callErr, i, elem, argNode(argNodes, i), args[i]); err != nil {
 				return nil, err
 			}
 		}
@@ -111,10 +120,28 @@ func checkCallArguments(global *Global, name string, fn *types.Signature, args [
 	return fn.Results().At(0).Type(), nil
 }
 
+// argNode returns the node of the i-th argument, or nil when the argument
+// was piped in.
+func argNode(argNodes []parse.Node, i int) parse.Node {
+	if i < len(argNodes) {
+		return argNodes[i]
+	}
+	return nil
+}
+
 // checkArgAssignable returns nil when at is assignable to pt, allowing one
 // level of pointer auto-deref or auto-address (matching template runtime
-// semantics). Returns an *Error built via callErr on mismatch.
-func checkArgAssignable(global *Global, callErr func(format string, a ...any) *Error, i int, pt, at types.Type) error {
+// semantics). Returns an *Error built via callErr on mismatch. Number
+// literals are checked by value, see checkNumberArg.
+func checkArgAssignable(global *Global, callErr func(format string, a ...any) *Error, i int, pt types.Type, node parse.Node, at types.Type) error {
+	if basic, ok := pt.Underlying().(*types.Basic); ok && basic.Info()&types.IsNumeric != 0 {
+		if n, ok := node.(*parse.NumberNode); ok {
+			if message := checkNumberArg(n, basic); message != "" {
+				return callErr("argument %d %s", i, message)
+			}
+			return nil
+		}
+	}
 	if types.AssignableTo(at, pt) {
 		return nil
 	}
@@ -127,6 +154,59 @@ func checkArgAssignable(global *Global, callErr func(format string, a ...any) *E
 	return callErr("argument %d has type %s expected %s", i, at, pt)
 }
 
+// checkNumberArg checks a number literal passed for a numeric parameter
+// the way text/template's evalArg converts it: an integer parameter needs
+// a literal with an exact integer value, an unsigned one a non-negative
+// integer, and so on. Unlike the runtime, which truncates silently, it also
+// reports literals that overflow the parameter's size. It returns a
+// description of the mismatch, or "" when the literal fits.
+func checkNumberArg(n *parse.NumberNode, basic *types.Basic) string {
+	info := basic.Info()
+	switch {
+	case info&types.IsUnsigned != 0:
+		if !n.IsUint {
+			return fmt.Sprintf("expected unsigned integer; found %s", n.Text)
+		}
+		if bits := basicBits(basic); bits < 64 && n.Uint64>>bits != 0 {
+			return fmt.Sprintf("constant %s overflows %s", n.Text, basic)
+		}
+	case info&types.IsInteger != 0:
+		if !n.IsInt {
+			return fmt.Sprintf("expected integer; found %s", n.Text)
+		}
+		if bits := basicBits(basic); bits < 64 && (n.Int64 < -1<<(bits-1) || n.Int64 > 1<<(bits-1)-1) {
+			return fmt.Sprintf("constant %s overflows %s", n.Text, basic)
+		}
+	case info&types.IsFloat != 0:
+		if !n.IsFloat {
+			return fmt.Sprintf("expected float; found %s", n.Text)
+		}
+		if basic.Kind() == types.Float32 && math.Abs(n.Float64) > math.MaxFloat32 {
+			return fmt.Sprintf("constant %s overflows %s", n.Text, basic)
+		}
+	case info&types.IsComplex != 0:
+		if !n.IsComplex {
+			return fmt.Sprintf("expected complex; found %s", n.Text)
+		}
+	}
+	return ""
+}
+
+// basicBits returns the size in bits of an integer kind, taking int, uint
+// and uintptr to be 64 bits wide.
+func basicBits(basic *types.Basic) uint {
+	switch basic.Kind() {
+	case types.Int8, types.Uint8:
+		return 8
+	case types.Int16, types.Uint16:
+		return 16
+	case types.Int32, types.Uint32:
+		return 32
+	default:
+		return 64
+	}
+}
+
 func findPackage(pkg *types.Package, path string) (*types.Package, bool) {
 	if pkg == nil {
 		return nil, false
@@ -167,28 +247,49 @@ func builtInCheck(global *Global, funcIdent string, nodes []parse.Node, argTypes
 		if l := len(argTypes); l < 1 || l > 4 {
 			return nil, errorf(ErrorTypeCallArguments, "built-in slice expects between 1 and 4 arguments got %d", len(argTypes))
 		}
-		for i := 1; i < len(nodes); i++ {
-			if n, ok := nodes[i].(*parse.NumberNode); ok && n.Int64 < 0 {
-				return nil, errorf(ErrorTypeCallArguments, "index %s out of bound", n.Text)
-			}
-		}
 		arg := argTypes[0]
+		var result types.Type
+		size := int64(-1)
 		switch x := arg.Underlying().(type) {
-		default:
-			return nil, errorf(ErrorTypeCallArguments, "built-in slice expects the first argument to be an array, slice, or string got %s", arg).withX(arg)
 		case *types.Basic:
-			if x.Kind() != types.String {
+			if x.Info()&types.IsString == 0 {
 				return nil, errorf(ErrorTypeCallArguments, "built-in slice expects the first argument to be an array, slice, or string got %s", arg).withX(arg)
 			}
-			if len(nodes) == 4 {
+			if len(argTypes) == 4 {
 				return nil, errorf(ErrorTypeCallArguments, "can not 3 index slice a string")
 			}
-			return types.Universe.Lookup("string").Type(), nil
-		case *types.Array:
-			return x.Elem(), nil
+			result = types.Default(arg)
 		case *types.Slice:
-			return x.Elem(), nil
+			result = arg
+		case *types.Array:
+			result, size = types.NewSlice(x.Elem()), x.Len()
+		case *types.Pointer:
+			array, ok := x.Elem().Underlying().(*types.Array)
+			if !ok {
+				return nil, errorf(ErrorTypeCallArguments, "built-in slice expects the first argument to be an array, slice, or string got %s", arg).withX(arg)
+			}
+			result, size = types.NewSlice(array.Elem()), array.Len()
+		default:
+			return nil, errorf(ErrorTypeCallArguments, "built-in slice expects the first argument to be an array, slice, or string got %s", arg).withX(arg)
 		}
+		// Like the runtime, check that each index is an integer within
+		// the capacity and that constant indexes are in order.
+		var prev int64 = -1
+		for i := 1; i < len(argTypes); i++ {
+			x, isConst, err := indexArg(nodes, i, argTypes[i], size)
+			if err != nil {
+				return nil, err
+			}
+			if !isConst {
+				prev = -1
+				continue
+			}
+			if prev > x {
+				return nil, errorf(ErrorTypeCallArguments, "invalid slice index: %d > %d", prev, x)
+			}
+			prev = x
+		}
+		return result, nil
 	case "and", "or":
 		if len(argTypes) < 1 {
 			return nil, errorf(ErrorTypeCallArguments, "built-in %s expects at least one argument got %d", funcIdent, len(argTypes))
@@ -213,7 +314,11 @@ func builtInCheck(global *Global, funcIdent string, nodes []parse.Node, argTypes
 		if !ok {
 			return nil, errorf(ErrorTypeCallArguments, "call expected a function signature").withX(argTypes[0])
 		}
-		return checkCallArguments(global, "", sig, argTypes[1:])
+		var argNodes []parse.Node
+		if len(nodes) > 1 {
+			argNodes = nodes[1:]
+		}
+		return checkCallArguments(global, "", sig, argNodes, argTypes[1:])
 	case "not":
 		if len(argTypes) < 1 {
 			return nil, errorf(ErrorTypeCallArguments, "built-in not expects at least one argument")
@@ -227,20 +332,36 @@ func builtInCheck(global *Global, funcIdent string, nodes []parse.Node, argTypes
 		for i := 1; i < len(argTypes); i++ {
 			at := argTypes[i]
 			result = dereference(result)
-			switch x := result.(type) {
+			switch x := result.Underlying().(type) {
 			case *types.Slice:
-				if !types.AssignableTo(at, types.Typ[types.Int]) {
-					return nil, errorf(ErrorTypeCallArguments, "slice index expects int got %s", at).withX(at)
+				if _, _, err := indexArg(nodes, i, at, -1); err != nil {
+					return nil, err
 				}
 				result = x.Elem()
 			case *types.Array:
-				if !types.AssignableTo(at, types.Typ[types.Int]) {
-					return nil, errorf(ErrorTypeCallArguments, "slice index expects int got %s", at).withX(at)
+				k, isConst, err := indexArg(nodes, i, at, x.Len())
+				if err != nil {
+					return nil, err
+				}
+				if isConst && k == x.Len() {
+					return nil, errorf(ErrorTypeCallArguments, "index out of range: %d", k)
 				}
 				result = x.Elem()
+			case *types.Basic:
+				if x.Info()&types.IsString == 0 {
+					return nil, errorf(ErrorTypeCallArguments, "can not index over %s", result).withX(result)
+				}
+				if _, _, err := indexArg(nodes, i, at, -1); err != nil {
+					return nil, err
+				}
+				result = types.Typ[types.Byte]
 			case *types.Map:
 				if !types.AssignableTo(at, x.Key()) {
-					return nil, errorf(ErrorTypeCallArguments, "slice index expects %s got %s", x.Key(), at).withX(at)
+					e := errorf(ErrorTypeCallArguments, "slice index expects %s got %s", x.Key(), at).withX(at)
+					if i < len(nodes) {
+						e.Fixes = indexKeyFix(nodes[i], x.Key())
+					}
+					return nil, e
 				}
 				result = x.Elem()
 			default:
@@ -252,3 +373,25 @@ func builtInCheck(global *Global, funcIdent string, nodes []parse.Node, argTypes
 		return nil, errorf(ErrorTypeUnknownFunction, "unknown function: %s", funcIdent)
 	}
 }
+
+// indexArg checks the i-th argument of slice or index the way
+// text/template's indexArg does: it must be an integer, and a constant
+// must lie in [0, size]. A negative size means the length is only known at
+// runtime. It returns the constant's value when the argument is a number
+// literal.
+func indexArg(nodes []parse.Node, i int, tp types.Type, size int64) (int64, bool, error) {
+	if basic, ok := tp.Underlying().(*types.Basic); !ok || basic.Info()&types.IsInteger == 0 {
+		return 0, false, errorf(ErrorTypeCallArguments, "cannot index slice/array with type %s", types.Default(tp)).withX(tp)
+	}
+	if i >= len(nodes) {
+		return 0, false, nil
+	}
+	n, ok := nodes[i].(*parse.NumberNode)
+	if !ok || !n.IsInt {
+		return 0, false, nil
+	}
+	if n.Int64 < 0 || (size >= 0 && n.Int64 > size) {
+		return 0, false, errorf(ErrorTypeCallArguments, "index out of range: %d", n.Int64)
+	}
+	return n.Int64, true, nil
+}
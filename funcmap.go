@@ -0,0 +1,128 @@
+package check
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+
+	"github.com/typelate/check/internal/asteval"
+)
+
+// funcMapProviders reads the FuncMap each name provides. A provider is a
+// package-level function returning a template.FuncMap composite literal,
+// or a package-level variable initialized with one, declared in pkg or a
+// package it imports. The package must have been loaded with syntax and
+// type information.
+func funcMapProviders(pkg *packages.Package, names []string) (asteval.FuncMapProviders, []error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	providers := make(asteval.FuncMapProviders)
+	var errs []error
+	for _, name := range names {
+		functions, err := funcMapProvider(pkg, name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("FuncMap provider %s: %w", name, err))
+			continue
+		}
+		providers[name] = functions
+	}
+	return providers, errs
+}
+
+func funcMapProvider(pkg *packages.Package, name string) (asteval.TemplateFunctions, error) {
+	i := strings.LastIndex(name, ".")
+	if i < 0 {
+		return nil, fmt.Errorf("expected a package path qualified name")
+	}
+	path, ident := name[:i], name[i+1:]
+	declPkg := findImport(pkg, path, make(map[*packages.Package]bool))
+	if declPkg == nil || declPkg.TypesInfo == nil {
+		return nil, fmt.Errorf("package %s is not loaded", path)
+	}
+	lit := funcMapLiteral(declPkg.Syntax, ident)
+	if lit == nil {
+		return nil, fmt.Errorf("no function returning or variable holding a template.FuncMap composite literal")
+	}
+	functions := make(asteval.TemplateFunctions)
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			return nil, fmt.Errorf("expected key value pairs")
+		}
+		funcName, ok := asteval.BasicLiteralString(kv.Key)
+		if !ok {
+			return nil, fmt.Errorf("expected string literal keys")
+		}
+		sig, ok := declPkg.TypesInfo.TypeOf(kv.Value).(*types.Signature)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a function", funcName)
+		}
+		functions[funcName] = sig
+	}
+	return functions, nil
+}
+
+// findImport returns the package with path among pkg and the packages it
+// imports, directly or not.
+func findImport(pkg *packages.Package, path string, visited map[*packages.Package]bool) *packages.Package {
+	if pkg.PkgPath == path {
+		return pkg
+	}
+	visited[pkg] = true
+	for _, imported := range pkg.Imports {
+		if visited[imported] {
+			continue
+		}
+		if found := findImport(imported, path, visited); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// funcMapLiteral finds the composite literal the package-level function
+// named ident returns, or the package-level variable named ident is
+// initialized with.
+func funcMapLiteral(files []*ast.File, ident string) *ast.CompositeLit {
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv != nil || decl.Name.Name != ident || decl.Body == nil {
+					continue
+				}
+				var lit *ast.CompositeLit
+				ast.Inspect(decl.Body, func(node ast.Node) bool {
+					switch node := node.(type) {
+					case *ast.FuncLit:
+						return false
+					case *ast.ReturnStmt:
+						if len(node.Results) == 1 && lit == nil {
+							lit, _ = node.Results[0].(*ast.CompositeLit)
+						}
+					}
+					return lit == nil
+				})
+				return lit
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					vs, ok := spec.(*ast.ValueSpec)
+					if !ok {
+						continue
+					}
+					for i, name := range vs.Names {
+						if name.Name == ident && i < len(vs.Values) {
+							lit, _ := vs.Values[i].(*ast.CompositeLit)
+							return lit
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
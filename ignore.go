@@ -0,0 +1,289 @@
+package check
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+	"text/template/parse"
+)
+
+// ignoreComment starts a template comment or Go line comment naming the
+// error types to suppress, by their ErrorType.String slugs:
+//
+//	{{/* check:ignore field-or-method-not-found */}}
+//	_ = templates.ExecuteTemplate(w, "page", data) //check:ignore nil-pointer
+//
+// A directive naming no types suppresses every type.
+const ignoreComment = "check:ignore"
+
+// suppression is one check:ignore directive. A template directive covers
+// region of tree, or all of tree when whole is set; a Go directive covers
+// every error found checking its ExecuteTemplate call.
+type suppression struct {
+	types []string
+	used  map[string]bool
+
+	tree    *parse.Tree
+	comment *parse.CommentNode
+	region  span
+	whole   bool
+
+	pos, end token.Position
+
+	// alone reports that a Go directive is the only thing on its line,
+	// so it also covers a call on the next line.
+	alone bool
+}
+
+// commentFields splits the text of a template comment into fields.
+func commentFields(n *parse.CommentNode) []string {
+	return strings.Fields(strings.TrimSuffix(strings.TrimPrefix(n.Text, "/*"), "*/"))
+}
+
+// templateSuppressions finds the check:ignore comments in tree. A comment
+// that starts the tree, after nothing but white space, covers the whole
+// tree, so one at the top of a {{define}} covers the definition. Any other
+// covers the next action or control structure in the same list.
+func templateSuppressions(tree *parse.Tree) []*suppression {
+	var found []*suppression
+	var visit func(list *parse.ListNode)
+	visit = func(list *parse.ListNode) {
+		if list == nil {
+			return
+		}
+		leading := list == tree.Root
+		for i, n := range list.Nodes {
+			switch n := n.(type) {
+			case *parse.TextNode:
+				leading = leading && strings.TrimSpace(string(n.Text)) == ""
+				continue
+			case *parse.CommentNode:
+				fields := commentFields(n)
+				if len(fields) == 0 || fields[0] != ignoreComment {
+					continue
+				}
+				s := &suppression{types: fields[1:], tree: tree, comment: n, whole: leading}
+				if !leading {
+					if next := nextCovered(list.Nodes[i+1:]); next != nil {
+						s.region = nodeExtent(next)
+					}
+				}
+				found = append(found, s)
+				continue
+			case *parse.IfNode:
+				visit(n.List)
+				visit(n.ElseList)
+			case *parse.RangeNode:
+				visit(n.List)
+				visit(n.ElseList)
+			case *parse.WithNode:
+				visit(n.List)
+				visit(n.ElseList)
+			}
+			leading = false
+		}
+	}
+	visit(tree.Root)
+	return found
+}
+
+// nextCovered returns the first node of nodes a check:ignore comment
+// before them applies to, skipping text and other comments.
+func nextCovered(nodes []parse.Node) parse.Node {
+	for _, n := range nodes {
+		switch n.(type) {
+		case *parse.TextNode, *parse.CommentNode:
+			continue
+		}
+		return n
+	}
+	return nil
+}
+
+// nodeExtent returns the span of n including, for control structures, the
+// lists they execute.
+func nodeExtent(n parse.Node) span {
+	var branch *parse.BranchNode
+	switch n := n.(type) {
+	case *parse.IfNode:
+		branch = &n.BranchNode
+	case *parse.RangeNode:
+		branch = &n.BranchNode
+	case *parse.WithNode:
+		branch = &n.BranchNode
+	default:
+		return nodeSpan(n)
+	}
+	s := nodeSpan(branch.Pipe)
+	for _, list := range []*parse.ListNode{branch.List, branch.ElseList} {
+		if list != nil {
+			s.end = max(s.end, nodeSpan(list).end)
+		}
+	}
+	return s
+}
+
+// goSuppressions finds the //check:ignore line comments in files, keyed by
+// the file and line they are on.
+func goSuppressions(fset *token.FileSet, files []*ast.File) map[lineKey]*suppression {
+	found := make(map[lineKey]*suppression)
+	for _, file := range files {
+		code := codeStarts(fset, file)
+		for _, group := range file.Comments {
+			for _, c := range group.List {
+				text, ok := strings.CutPrefix(c.Text, "//")
+				if !ok {
+					continue
+				}
+				fields := strings.Fields(text)
+				if len(fields) == 0 || fields[0] != ignoreComment {
+					continue
+				}
+				pos := fset.Position(c.Pos())
+				start, ok := code[pos.Line]
+				found[lineKey{pos.Filename, pos.Line}] = &suppression{
+					types: fields[1:],
+					pos:   pos,
+					end:   fset.Position(c.End()),
+					alone: !ok || start > pos.Offset,
+				}
+			}
+		}
+	}
+	return found
+}
+
+// codeStarts returns the offset of the first code on each line of file
+// that has any, counting the lines where a node starts or ends.
+func codeStarts(fset *token.FileSet, file *ast.File) map[int]int {
+	starts := make(map[int]int)
+	mark := func(p token.Pos) {
+		pos := fset.Position(p)
+		if start, ok := starts[pos.Line]; !ok || pos.Offset < start {
+			starts[pos.Line] = pos.Offset
+		}
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n.(type) {
+		case nil, *ast.CommentGroup, *ast.Comment:
+			return false
+		}
+		mark(n.Pos())
+		mark(n.End() - 1)
+		return true
+	})
+	return starts
+}
+
+// lineKey identifies a line of a Go file.
+type lineKey struct {
+	filename string
+	line     int
+}
+
+// callSuppression returns the //check:ignore comment on the line of call
+// or, when it stands alone there, on the line above it. A directive
+// trailing the code of the line above belongs to that code.
+func callSuppression(fset *token.FileSet, directives map[lineKey]*suppression, call *ast.CallExpr) *suppression {
+	pos := fset.Position(call.Pos())
+	if s, ok := directives[lineKey{pos.Filename, pos.Line}]; ok {
+		return s
+	}
+	if s, ok := directives[lineKey{pos.Filename, pos.Line - 1}]; ok && s.alone {
+		return s
+	}
+	return nil
+}
+
+// covers reports whether s applies to the leaf error e and, if so, which
+// of its types matched.
+func (s *suppression) covers(e *Error) (string, bool) {
+	if s.tree != nil {
+		if e.Tree != s.tree || (!s.whole && e.Node == nil) {
+			return "", false
+		}
+		if !s.whole {
+			if pos := int(e.Node.Position()); pos < s.region.pos || pos >= s.region.end {
+				return "", false
+			}
+		}
+	}
+	if len(s.types) == 0 {
+		return "", true
+	}
+	slug := e.Type.String()
+	for _, t := range s.types {
+		if t == slug {
+			return slug, true
+		}
+	}
+	return "", false
+}
+
+// suppress returns err without the leaf errors a suppression in sups
+// covers, recording on each suppression which of its types were used.
+// Aggregates left with one child collapse to it, and with none to nil.
+func suppress(err *Error, sups []*suppression) *Error {
+	if len(err.children) == 0 {
+		if err.Type == ErrorTypeAggregate {
+			return err
+		}
+		dropped := false
+		for _, s := range sups {
+			if slug, ok := s.covers(err); ok {
+				if s.used == nil {
+					s.used = make(map[string]bool)
+				}
+				s.used[slug] = true
+				dropped = true
+			}
+		}
+		if dropped {
+			return nil
+		}
+		return err
+	}
+	var children []*Error
+	for _, child := range err.children {
+		if kept := suppress(child, sups); kept != nil {
+			children = append(children, kept)
+		}
+	}
+	switch len(children) {
+	case 0:
+		return nil
+	case 1:
+		return children[0]
+	}
+	pruned := *err
+	pruned.children = children
+	return &pruned
+}
+
+// unused reports each type s names that suppressed no error, or s itself
+// when it names no types and suppressed nothing. sources maps trees to the
+// text they were parsed from.
+func (s *suppression) unused(sources map[*parse.Tree]string) []*Error {
+	slugs := s.types
+	if len(slugs) == 0 {
+		slugs = []string{""}
+	}
+	var errs []*Error
+	for _, t := range slugs {
+		if s.used[t] {
+			continue
+		}
+		directive := strings.TrimSpace(ignoreComment + " " + t)
+		var e *Error
+		if s.tree != nil {
+			e = newError(ErrorTypeUnusedSuppression, s.tree, s.comment, "%s suppresses no error", directive)
+			e.locate(sources)
+		} else {
+			e = errorf(ErrorTypeUnusedSuppression, "%s suppresses no error", directive)
+			e.Start, e.End = s.pos, s.end
+		}
+		e.Severity = SeverityWarning
+		errs = append(errs, e)
+	}
+	return errs
+}
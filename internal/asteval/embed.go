@@ -0,0 +1,392 @@
+package asteval
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/typelate/check/internal/astgen"
+)
+
+// EmbeddedFiles describes the files a package embeds, which ParseFS calls
+// on its embed.FS variables read.
+type EmbeddedFiles struct {
+	// Dir is the package directory.
+	Dir string
+
+	// Syntax and TypesInfo are the package's files, where its embed.FS
+	// variables are declared, and their type information.
+	Syntax    []*ast.File
+	TypesInfo *types.Info
+
+	// Paths are the embedded files, relative to Dir.
+	Paths []string
+
+	// FS holds the files of Dir.
+	FS fs.FS
+
+	// Import returns the embedded files of the package with the given
+	// import path, for embed.FS variables declared in an imported package.
+	// It may be nil.
+	Import func(path string) (*EmbeddedFiles, error)
+}
+
+// embedDir is a directory of the files embedded in a package, as fs.Sub
+// narrows an embed.FS.
+type embedDir struct {
+	files *EmbeddedFiles
+
+	// dir is the slash separated directory, relative to files.Dir.
+	dir string
+
+	// paths are the embedded files under dir, relative to files.Dir.
+	paths []string
+}
+
+// resolveEmbedDir finds the embedded files the fs.FS expression exp holds.
+// It follows package-level variables, embed.FS variables of imported
+// packages, and fs.Sub calls with a literal directory, whether made
+// directly or by a package-level helper passing its parameters to fs.Sub.
+func resolveEmbedDir(workingDirectory string, fileSet *token.FileSet, files *EmbeddedFiles, exp ast.Expr, seen map[*ast.ValueSpec]bool) (embedDir, error) {
+	switch exp := exp.(type) {
+	case *ast.ParenExpr:
+		return resolveEmbedDir(workingDirectory, fileSet, files, exp.X, seen)
+	case *ast.Ident:
+		return resolveEmbedVar(workingDirectory, fileSet, files, exp, exp.Name, seen)
+	case *ast.SelectorExpr:
+		imported, ok := importedPackage(files, exp.X)
+		if !ok {
+			break
+		}
+		if files.Import == nil {
+			return embedDir{}, wrapWithFilename(workingDirectory, fileSet, exp.Pos(), fmt.Errorf("package %s is not loaded", imported.Path()))
+		}
+		importedFiles, err := files.Import(imported.Path())
+		if err != nil {
+			return embedDir{}, wrapWithFilename(workingDirectory, fileSet, exp.Pos(), err)
+		}
+		return resolveEmbedVar(workingDirectory, fileSet, importedFiles, exp, exp.Sel.Name, seen)
+	case *ast.CallExpr:
+		fsys, dir, ok := subCallArgs(files, exp)
+		if !ok {
+			break
+		}
+		sub, ok := BasicLiteralString(dir)
+		if !ok || !fs.ValidPath(sub) {
+			return embedDir{}, wrapWithFilename(workingDirectory, fileSet, dir.Pos(), fmt.Errorf("expected a string literal directory got %s", astgen.Format(dir)))
+		}
+		parent, err := resolveEmbedDir(workingDirectory, fileSet, files, fsys, seen)
+		if err != nil {
+			return embedDir{}, err
+		}
+		return parent.sub(sub), nil
+	}
+	return embedDir{}, wrapWithFilename(workingDirectory, fileSet, exp.Pos(), fmt.Errorf("first argument to ParseFS must be an embed.FS variable or an fs.Sub of one got %s", astgen.Format(exp)))
+}
+
+// resolveEmbedVar resolves the package-level variable named name declared
+// in files: an embed.FS with //go:embed directives, or a variable
+// initialized from an expression resolveEmbedDir follows.
+func resolveEmbedVar(workingDirectory string, fileSet *token.FileSet, files *EmbeddedFiles, exp ast.Expr, name string, seen map[*ast.ValueSpec]bool) (embedDir, error) {
+	for file, decl := range astgen.IterateGenDecl(files.Syntax, token.VAR) {
+		for _, s := range decl.Specs {
+			spec, ok := s.(*ast.ValueSpec)
+			if !ok {
+				continue
+			}
+			i := slices.IndexFunc(spec.Names, func(e *ast.Ident) bool { return e.Name == name })
+			if i < 0 {
+				continue
+			}
+			if directives := embedDirectives(file, decl, spec); len(directives) > 0 {
+				paths, err := embeddedFiles(directives, files.Paths)
+				if err != nil {
+					return embedDir{}, wrapWithFilename(workingDirectory, fileSet, directives[0].Pos(), fmt.Errorf("embed comment malformed: %w", err))
+				}
+				return embedDir{files: files, dir: ".", paths: paths}, nil
+			}
+			var value ast.Expr
+			switch {
+			case len(spec.Values) == len(spec.Names):
+				value = spec.Values[i]
+			case len(spec.Values) == 1 && i == 0:
+				// var templates, err = fs.Sub(assets, "templates")
+				value = spec.Values[0]
+			}
+			if value == nil || seen[spec] {
+				return embedDir{}, wrapWithFilename(workingDirectory, fileSet, exp.Pos(), fmt.Errorf("variable %s has no //go:embed directive", name))
+			}
+			if seen == nil {
+				seen = make(map[*ast.ValueSpec]bool)
+			}
+			seen[spec] = true
+			return resolveEmbedDir(workingDirectory, fileSet, files, value, seen)
+		}
+	}
+	return embedDir{}, wrapWithFilename(workingDirectory, fileSet, exp.Pos(), fmt.Errorf("variable %s not found", name))
+}
+
+// importedPackage returns the package x names, if it is a package name.
+func importedPackage(files *EmbeddedFiles, x ast.Expr) (*types.Package, bool) {
+	ident, ok := x.(*ast.Ident)
+	if !ok || files.TypesInfo == nil {
+		return nil, false
+	}
+	pkgName, ok := files.TypesInfo.Uses[ident].(*types.PkgName)
+	if !ok {
+		return nil, false
+	}
+	return pkgName.Imported(), true
+}
+
+// subCallArgs returns the file system and directory arguments of call
+// when it calls fs.Sub, or a package-level function of files whose body
+// passes two of its parameters, or a parameter and a string literal, to
+// fs.Sub; the arguments are then those call passes for them.
+func subCallArgs(files *EmbeddedFiles, call *ast.CallExpr) (ast.Expr, ast.Expr, bool) {
+	if isSubCall(files.TypesInfo, call) {
+		return call.Args[0], call.Args[1], true
+	}
+	ident, ok := call.Fun.(*ast.Ident)
+	if !ok || files.TypesInfo == nil {
+		return nil, nil, false
+	}
+	fn, ok := files.TypesInfo.Uses[ident].(*types.Func)
+	if !ok {
+		return nil, nil, false
+	}
+	decl := findFuncDecl(files.Syntax, fn)
+	if decl == nil || decl.Body == nil {
+		return nil, nil, false
+	}
+	var params []*ast.Ident
+	for _, field := range decl.Type.Params.List {
+		params = append(params, field.Names...)
+	}
+	if len(params) != len(call.Args) {
+		return nil, nil, false
+	}
+	argument := func(exp ast.Expr) ast.Expr {
+		if lit, ok := exp.(*ast.BasicLit); ok {
+			return lit
+		}
+		ident, ok := exp.(*ast.Ident)
+		if !ok {
+			return nil
+		}
+		i := slices.IndexFunc(params, func(p *ast.Ident) bool { return files.TypesInfo.Uses[ident] == files.TypesInfo.Defs[p] })
+		if i < 0 {
+			return nil
+		}
+		return call.Args[i]
+	}
+	var fsys, dir ast.Expr
+	ast.Inspect(decl.Body, func(node ast.Node) bool {
+		sub, ok := node.(*ast.CallExpr)
+		if !ok || fsys != nil || !isSubCall(files.TypesInfo, sub) {
+			return fsys == nil
+		}
+		if f, d := argument(sub.Args[0]), argument(sub.Args[1]); f != nil && d != nil {
+			fsys, dir = f, d
+		}
+		return false
+	})
+	return fsys, dir, fsys != nil
+}
+
+// isSubCall reports whether call calls io/fs.Sub.
+func isSubCall(info *types.Info, call *ast.CallExpr) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || info == nil || len(call.Args) != 2 {
+		return false
+	}
+	fn, ok := info.Uses[sel.Sel].(*types.Func)
+	return ok && fn.Pkg() != nil && fn.Pkg().Path() == "io/fs" && fn.Name() == "Sub"
+}
+
+// findFuncDecl returns the declaration of the package-level function fn.
+func findFuncDecl(files []*ast.File, fn *types.Func) *ast.FuncDecl {
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			if decl, ok := decl.(*ast.FuncDecl); ok && decl.Recv == nil && decl.Name.Pos() == fn.Pos() {
+				return decl
+			}
+		}
+	}
+	return nil
+}
+
+// sub returns the directory name of d, as fs.Sub would: d itself when
+// name is ".".
+func (d embedDir) sub(name string) embedDir {
+	if name == "." {
+		return d
+	}
+	dir := path.Join(d.dir, name)
+	var paths []string
+	for _, p := range d.paths {
+		if strings.HasPrefix(filepath.ToSlash(p), dir+"/") {
+			paths = append(paths, p)
+		}
+	}
+	return embedDir{files: d.files, dir: dir, paths: paths}
+}
+
+// rel returns p, one of d.paths, relative to d.dir as ParseFS patterns
+// are matched against it.
+func (d embedDir) rel(p string) string {
+	p = filepath.ToSlash(p)
+	if d.dir == "." {
+		return p
+	}
+	return strings.TrimPrefix(p, d.dir+"/")
+}
+
+// goEmbedDirective starts a //go:embed line comment.
+const goEmbedDirective = "//go:embed"
+
+// embedDirectives returns the //go:embed comments for spec. As the
+// compiler requires, they come before the declaration with nothing but
+// blank lines and other line comments in between, so they need not all be
+// in spec's doc comment.
+func embedDirectives(file *ast.File, decl *ast.GenDecl, spec *ast.ValueSpec) []*ast.Comment {
+	from, to := file.Name.End(), decl.Pos()
+	if decl.Lparen.IsValid() {
+		from, to = decl.Lparen, spec.Pos()
+		for _, s := range decl.Specs {
+			if s.End() <= to {
+				from = s.End()
+			}
+		}
+	} else {
+		for _, d := range file.Decls {
+			if d.End() <= to {
+				from = d.End()
+			}
+		}
+	}
+	var directives []*ast.Comment
+	for _, group := range file.Comments {
+		if group.Pos() < from || group.End() > to {
+			continue
+		}
+		for _, c := range group.List {
+			if rest, ok := strings.CutPrefix(c.Text, goEmbedDirective); ok && (rest == "" || rest[0] == ' ' || rest[0] == '\t') {
+				directives = append(directives, c)
+			}
+		}
+	}
+	return directives
+}
+
+// embedPatterns parses the patterns of a //go:embed directive: space
+// separated, each either unquoted or a Go string literal.
+func embedPatterns(directive string) ([]string, error) {
+	var patterns []string
+	rest := strings.TrimLeft(strings.TrimPrefix(directive, goEmbedDirective), " \t")
+	for rest != "" {
+		var pattern string
+		switch rest[0] {
+		case '"', '`':
+			quoted, err := strconv.QuotedPrefix(rest)
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted string in %s: %s", goEmbedDirective, rest)
+			}
+			pattern, _ = strconv.Unquote(quoted)
+			rest = rest[len(quoted):]
+			if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+				return nil, fmt.Errorf("invalid quoted string in %s: %s", goEmbedDirective, rest)
+			}
+		default:
+			end := strings.IndexAny(rest, " \t")
+			if end < 0 {
+				end = len(rest)
+			}
+			pattern, rest = rest[:end], rest[end:]
+		}
+		patterns = append(patterns, pattern)
+		rest = strings.TrimLeft(rest, " \t")
+	}
+	return patterns, nil
+}
+
+// embeddedFiles returns the paths, the files a package embeds relative to
+// its directory, that directives embed. Since go build already resolved
+// the package's patterns to paths, only which of them each pattern
+// embeds is worked out here, with go build's rules: a pattern matching a
+// file embeds it, and one matching a directory embeds the files below it
+// except those under a name beginning with '.' or '_', unless the pattern
+// has the all: prefix.
+func embeddedFiles(directives []*ast.Comment, paths []string) ([]string, error) {
+	var patterns []string
+	for _, directive := range directives {
+		list, err := embedPatterns(directive.Text)
+		if err != nil {
+			return nil, err
+		}
+		for _, pattern := range list {
+			glob := strings.TrimPrefix(pattern, "all:")
+			if glob == "." || !fs.ValidPath(glob) {
+				return nil, fmt.Errorf("invalid pattern syntax: %s", pattern)
+			}
+			if _, err := path.Match(glob, ""); err != nil {
+				return nil, fmt.Errorf("pattern %s: %w", pattern, err)
+			}
+		}
+		patterns = append(patterns, list...)
+	}
+	var matches []string
+	for _, p := range paths {
+		if slices.ContainsFunc(patterns, func(pattern string) bool { return embeds(pattern, filepath.ToSlash(p)) }) {
+			matches = append(matches, p)
+		}
+	}
+	return matches, nil
+}
+
+// EmbeddedPaths returns the files of fsys, a package directory, that the
+// //go:embed patterns embed, relative to its root. It stands in for the
+// list go build makes when the directory is not read from disk.
+func EmbeddedPaths(fsys fs.FS, patterns []string) ([]string, error) {
+	var paths []string
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if slices.ContainsFunc(patterns, func(pattern string) bool { return embeds(pattern, name) }) {
+			paths = append(paths, filepath.FromSlash(name))
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// embeds reports whether the //go:embed pattern embeds the file name, a
+// slash separated path relative to the package directory.
+func embeds(pattern, name string) bool {
+	glob, all := strings.CutPrefix(pattern, "all:")
+	elems := strings.Split(name, "/")
+	n := strings.Count(glob, "/") + 1
+	if n > len(elems) {
+		return false
+	}
+	if match, _ := path.Match(glob, strings.Join(elems[:n], "/")); !match {
+		return false
+	}
+	if all {
+		return true
+	}
+	for _, elem := range elems[n:] {
+		if strings.HasPrefix(elem, ".") || strings.HasPrefix(elem, "_") {
+			return false
+		}
+	}
+	return true
+}
@@ -18,3 +18,13 @@ func (f *Forrest) FindTree(name string) (*parse.Tree, bool) {
 	}
 	return ts.Tree, true
 }
+
+func (f *Forrest) TreeNames() []string {
+	var names []string
+	for _, t := range (*template.Template)(f).Templates() {
+		if t.Tree != nil {
+			names = append(names, t.Name())
+		}
+	}
+	return names
+}
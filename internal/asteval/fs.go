@@ -0,0 +1,83 @@
+package asteval
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ReadFile reads filename, or returns its contents in overlay when it has
+// them. Like packages.Config.Overlay, overlay is keyed by absolute path.
+func ReadFile(overlay map[string][]byte, filename string) ([]byte, error) {
+	if len(overlay) > 0 {
+		if abs, err := filepath.Abs(filename); err == nil {
+			if contents, ok := overlay[abs]; ok {
+				return contents, nil
+			}
+		}
+	}
+	return os.ReadFile(filename)
+}
+
+// OverlayFS returns a file system holding the files of dir on disk, with
+// the contents of any file in overlay, keyed by absolute path, replacing
+// or adding to them.
+func OverlayFS(dir string, overlay map[string][]byte) fs.FS {
+	if len(overlay) == 0 {
+		return os.DirFS(dir)
+	}
+	return overlayFS{dir: dir, overlay: overlay, disk: os.DirFS(dir)}
+}
+
+type overlayFS struct {
+	dir     string
+	overlay map[string][]byte
+	disk    fs.FS
+}
+
+func (o overlayFS) contents(name string) ([]byte, bool) {
+	abs, err := filepath.Abs(filepath.Join(o.dir, filepath.FromSlash(name)))
+	if err != nil {
+		return nil, false
+	}
+	contents, ok := o.overlay[abs]
+	return contents, ok
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if contents, ok := o.contents(name); ok {
+		return &overlayFile{name: filepath.Base(name), Reader: bytes.NewReader(contents), size: int64(len(contents))}, nil
+	}
+	return o.disk.Open(name)
+}
+
+func (o overlayFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	if contents, ok := o.contents(name); ok {
+		return bytes.Clone(contents), nil
+	}
+	return fs.ReadFile(o.disk, name)
+}
+
+// overlayFile is an open overlay file; it is its own fs.FileInfo.
+type overlayFile struct {
+	name string
+	*bytes.Reader
+	size int64
+}
+
+func (f *overlayFile) Stat() (fs.FileInfo, error) { return f, nil }
+func (f *overlayFile) Close() error               { return nil }
+func (f *overlayFile) Name() string               { return f.name }
+func (f *overlayFile) Size() int64                { return f.size }
+func (f *overlayFile) Mode() fs.FileMode          { return 0o444 }
+func (f *overlayFile) ModTime() time.Time         { return time.Time{} }
+func (f *overlayFile) IsDir() bool                { return false }
+func (f *overlayFile) Sys() any                   { return nil }
@@ -7,13 +7,14 @@ import (
 	"go/format"
 	"go/token"
 	"go/types"
-	"os"
+	"io/fs"
+	"maps"
+	"path"
 	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
 	"text/template/parse"
-	"unicode"
 
 	"github.com/typelate/check/internal/astgen"
 )
@@ -27,19 +28,212 @@ type Template interface {
 	Option(opt ...string) Template
 	Delims(left, right string) Template
 	Lookup(name string) Template
+	Clone() (Template, error)
 	Name() string
 	AddParseTree(name string, tree *parse.Tree) (Template, error)
 	Tree() *parse.Tree
 	FindTree(name string) (*parse.Tree, bool)
+	TreeNames() []string
 }
 
 // TemplateMetadata accumulates metadata during template evaluation.
 type TemplateMetadata struct {
 	EmbedFilePaths []string
 	ParseCalls     []*ast.BasicLit
+
+	// ParseTrees maps each tree a Parse call defined to the string literal
+	// it was parsed from.
+	ParseTrees map[*parse.Tree]*ast.BasicLit
+
+	// Overridable holds the trees later definitions are meant to replace:
+	// those {{block}} actions defined and those a Clone copied.
+	Overridable map[*parse.Tree]bool
+
+	// Redefinitions lists the definitions that replaced an earlier one.
+	Redefinitions []Redefinition
+
+	// Sources maps each tree parsed to the text it was parsed from, which
+	// the positions of its nodes are offsets into.
+	Sources map[*parse.Tree]string
+}
+
+// Redefinition is a template definition replacing an earlier, non-empty
+// one of the same name, which the template packages do silently.
+type Redefinition struct {
+	Tree, Previous *parse.Tree
+
+	// BaseName reports that Tree and Previous are the templates of two
+	// files in different directories with the same base name, which
+	// ParseFS names templates by.
+	BaseName bool
+}
+
+// Merge adds what other accumulated to meta.
+func (meta *TemplateMetadata) Merge(other *TemplateMetadata) {
+	meta.EmbedFilePaths = append(meta.EmbedFilePaths, other.EmbedFilePaths...)
+	meta.ParseCalls = append(meta.ParseCalls, other.ParseCalls...)
+	meta.Redefinitions = append(meta.Redefinitions, other.Redefinitions...)
+	if len(other.ParseTrees) > 0 && meta.ParseTrees == nil {
+		meta.ParseTrees = make(map[*parse.Tree]*ast.BasicLit)
+	}
+	maps.Copy(meta.ParseTrees, other.ParseTrees)
+	if len(other.Overridable) > 0 && meta.Overridable == nil {
+		meta.Overridable = make(map[*parse.Tree]bool)
+	}
+	maps.Copy(meta.Overridable, other.Overridable)
+	if len(other.Sources) > 0 && meta.Sources == nil {
+		meta.Sources = make(map[*parse.Tree]string)
+	}
+	maps.Copy(meta.Sources, other.Sources)
+}
+
+// recordSources notes in meta that each of trees was parsed from text.
+func (meta *TemplateMetadata) recordSources(text string, trees map[string]*parse.Tree) {
+	if meta == nil {
+		return
+	}
+	if meta.Sources == nil {
+		meta.Sources = make(map[*parse.Tree]string)
+	}
+	for _, tree := range trees {
+		meta.Sources[tree] = text
+	}
+}
+
+// recordDefinitions notes in meta which of trees, parsed from text with
+// rightDelim closing actions, a {{block}} defined, and which replace a
+// non-empty definition in t that is not overridable. file is the absolute
+// path text was read from, or empty for a Parse call; a file parsed again
+// replaces only its own definitions.
+func (meta *TemplateMetadata) recordDefinitions(t Template, text, rightDelim, file string, trees map[string]*parse.Tree) {
+	if meta == nil {
+		return
+	}
+	for _, tree := range trees {
+		forEachTemplateNode(tree.Root, func(n *parse.TemplateNode) {
+			block, ok := trees[n.Name]
+			if !ok || !isBlock(text, rightDelim, n, block) {
+				return
+			}
+			if meta.Overridable == nil {
+				meta.Overridable = make(map[*parse.Tree]bool)
+			}
+			meta.Overridable[block] = true
+		})
+	}
+	if t == nil {
+		return
+	}
+	for _, name := range slices.Sorted(maps.Keys(trees)) {
+		tree := trees[name]
+		previous, ok := t.FindTree(name)
+		if !ok || previous == nil || previous == tree || (file != "" && previous.ParseName == file) {
+			continue
+		}
+		if file != "" && name == filepath.Base(file) && filepath.IsAbs(previous.ParseName) && previous.ParseName != file {
+			meta.Redefinitions = append(meta.Redefinitions, Redefinition{Tree: tree, Previous: previous, BaseName: true})
+			continue
+		}
+		if parse.IsEmptyTree(tree.Root) || parse.IsEmptyTree(previous.Root) || meta.Overridable[previous] {
+			continue
+		}
+		meta.Redefinitions = append(meta.Redefinitions, Redefinition{Tree: tree, Previous: previous})
+	}
+}
+
+// isBlock reports whether n, a {{template}} action in text, is the one a
+// {{block}} leaves in place of tree, the definition it names: the list of
+// a block's definition starts where its action closes, while any other
+// definition follows a {{define}} action of its own.
+func isBlock(text, rightDelim string, n *parse.TemplateNode, tree *parse.Tree) bool {
+	if rightDelim == "" {
+		rightDelim = "}}"
+	}
+	start, end := int(n.Pos), int(tree.Root.Pos)
+	if start >= end || end > len(text) {
+		return false
+	}
+	action := text[start:end]
+	for i := 0; i < len(action); i++ {
+		switch {
+		case strings.HasPrefix(action[i:], rightDelim):
+			return strings.TrimSpace(action[i+len(rightDelim):]) == ""
+		case action[i] == '"' || action[i] == '`' || action[i] == '\'':
+			// Skip the template name and string arguments.
+			if quoted, err := strconv.QuotedPrefix(action[i:]); err == nil {
+				i += len(quoted) - 1
+			}
+		}
+	}
+	return false
+}
+
+// forEachTemplateNode calls f with each {{template}} action under n,
+// including the ones {{block}} actions leave in place.
+func forEachTemplateNode(n parse.Node, f func(*parse.TemplateNode)) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			forEachTemplateNode(child, f)
+		}
+	case *parse.TemplateNode:
+		f(n)
+	case *parse.IfNode:
+		forEachTemplateNode(n.List, f)
+		forEachTemplateNode(n.ElseList, f)
+	case *parse.RangeNode:
+		forEachTemplateNode(n.List, f)
+		forEachTemplateNode(n.ElseList, f)
+	case *parse.WithNode:
+		forEachTemplateNode(n.List, f)
+		forEachTemplateNode(n.ElseList, f)
+	}
+}
+
+// parseLiteral parses text, the value of the Parse argument arg, into t
+// the way Template.Parse does. When arg is a string literal, meta records
+// it along with the trees it defined.
+func parseLiteral(t Template, text string, arg ast.Expr, meta *TemplateMetadata, fm map[string]any, leftDelim, rightDelim string) (Template, error) {
+	before := make(map[*parse.Tree]bool)
+	for _, name := range t.TreeNames() {
+		if tree, ok := t.FindTree(name); ok {
+			before[tree] = true
+		}
+	}
+	// Comments are kept so the checker can read check: directives.
+	tree := parse.New(t.Name())
+	tree.Mode = parse.ParseComments
+	trees := make(map[string]*parse.Tree)
+	if _, err := tree.Parse(text, leftDelim, rightDelim, trees, fm, builtins()); err != nil {
+		return nil, err
+	}
+	meta.recordDefinitions(t, text, rightDelim, "", trees)
+	meta.recordSources(text, trees)
+	for _, tree := range trees {
+		if _, err := t.AddParseTree(tree.Name, tree); err != nil {
+			return nil, err
+		}
+	}
+	bl, ok := arg.(*ast.BasicLit)
+	if !ok || meta == nil {
+		return t, nil
+	}
+	meta.ParseCalls = append(meta.ParseCalls, bl)
+	for _, name := range t.TreeNames() {
+		if tree, ok := t.FindTree(name); ok && !before[tree] {
+			if meta.ParseTrees == nil {
+				meta.ParseTrees = make(map[*parse.Tree]*ast.BasicLit)
+			}
+			meta.ParseTrees[tree] = bl
+		}
+	}
+	return t, nil
 }
 
-func EvaluateTemplateSelector(ts Template, pkg *types.Package, typesInfo *types.Info, expression ast.Expr, workingDirectory, templatesVariable, rDelim, lDelim string, fileSet *token.FileSet, files []*ast.File, embeddedPaths []string, funcTypeMaps TemplateFunctions, fm map[string]any, meta *TemplateMetadata) (Template, string, string, error) {
+func EvaluateTemplateSelector(ts Template, pkg *types.Package, typesInfo *types.Info, expression ast.Expr, workingDirectory, templatesVariable, rDelim, lDelim string, fileSet *token.FileSet, embeds *EmbeddedFiles, funcTypeMaps TemplateFunctions, providers FuncMapProviders, variables TemplateVariables, fm map[string]any, meta *TemplateMetadata) (Template, string, string, error) {
 	call, ok := expression.(*ast.CallExpr)
 	if !ok {
 		return nil, lDelim, rDelim, wrapWithFilename(workingDirectory, fileSet, expression.Pos(), fmt.Errorf("expected call expression"))
@@ -53,39 +247,86 @@ func EvaluateTemplateSelector(ts Template, pkg *types.Package, typesInfo *types.
 		return nil, lDelim, rDelim, wrapWithFilename(workingDirectory, fileSet, sel.X.Pos(), fmt.Errorf("expected exactly one argument %s got %d", astgen.Format(sel.X), len(call.Args)))
 	case *ast.Ident:
 		if !IsTemplatePkgIdent(typesInfo, x) {
+			// Variable receiver — apply method to the template it holds.
+			from := meta
+			// Errors resolving the variable already carry its position.
+			if held, heldMeta, err := variables.lookup(typesInfo, x); err != nil {
+				return nil, lDelim, rDelim, err
+			} else if held != nil {
+				ts, from = held, heldMeta
+			}
 			if ts == nil {
 				return nil, lDelim, rDelim, wrapWithFilename(workingDirectory, fileSet, sel.X.Pos(), fmt.Errorf("expected template package got %s", astgen.Format(sel.X)))
 			}
-			// Variable receiver — apply method to existing template.
 			switch sel.Sel.Name {
+			case "Clone":
+				t, err := cloneTemplate(ts, from, meta)
+				return t, lDelim, rDelim, err
+			case "Lookup", "New":
+				if len(call.Args) != 1 {
+					return nil, lDelim, rDelim, wrapWithFilename(workingDirectory, fileSet, call.Lparen, fmt.Errorf("expected exactly one string literal argument"))
+				}
+				name, err := StringLiteralExpression(workingDirectory, fileSet, call.Args[0])
+				if err != nil {
+					return nil, lDelim, rDelim, err
+				}
+				if sel.Sel.Name == "New" {
+					return ts.New(name), lDelim, rDelim, nil
+				}
+				t := ts.Lookup(name)
+				if t == nil {
+					return nil, lDelim, rDelim, wrapWithFilename(workingDirectory, fileSet, call.Args[0].Pos(), fmt.Errorf("template %q not defined on %s", name, x.Name))
+				}
+				return t, lDelim, rDelim, nil
+			case "AddParseTree":
+				if len(call.Args) != 2 {
+					return nil, lDelim, rDelim, wrapWithFilename(workingDirectory, fileSet, call.Lparen, fmt.Errorf("expected a string literal name and a template's Tree"))
+				}
+				name, err := StringLiteralExpression(workingDirectory, fileSet, call.Args[0])
+				if err != nil {
+					return nil, lDelim, rDelim, err
+				}
+				treeSel, ok := call.Args[1].(*ast.SelectorExpr)
+				if !ok || treeSel.Sel.Name != "Tree" {
+					return nil, lDelim, rDelim, wrapWithFilename(workingDirectory, fileSet, call.Args[1].Pos(), fmt.Errorf("expected the Tree of a template got %s", astgen.Format(call.Args[1])))
+				}
+				var source Template
+				if ident, ok := treeSel.X.(*ast.Ident); ok {
+					source, _, err = variables.lookup(typesInfo, ident)
+				} else {
+					source, _, _, err = EvaluateTemplateSelector(nil, pkg, typesInfo, treeSel.X, workingDirectory, templatesVariable, rDelim, lDelim, fileSet, embeds, funcTypeMaps, providers, variables, fm, meta)
+				}
+				if err != nil {
+					return nil, lDelim, rDelim, err
+				}
+				if source == nil || source.Tree() == nil {
+					return nil, lDelim, rDelim, wrapWithFilename(workingDirectory, fileSet, treeSel.X.Pos(), fmt.Errorf("expected a template got %s", astgen.Format(treeSel.X)))
+				}
+				t, err := ts.AddParseTree(name, source.Tree())
+				return t, lDelim, rDelim, err
 			case "ParseFS":
-				filePaths, err := evaluateCallParseFilesArgs(workingDirectory, fileSet, call, files, embeddedPaths)
+				files, filePaths, err := evaluateCallParseFilesArgs(workingDirectory, fileSet, call, embeds)
 				if err != nil {
 					return nil, lDelim, rDelim, err
 				}
 				if meta != nil {
-					meta.EmbedFilePaths = append(meta.EmbedFilePaths, filePaths...)
+					meta.EmbedFilePaths = append(meta.EmbedFilePaths, joinFilePaths(files.Dir, filePaths...)...)
 				}
 				pkgPath := templatePkgPath(typesInfo, x)
-				t, err := parseFiles(ts, pkgPath, fm, lDelim, rDelim, filePaths...)
+				t, err := parseFiles(ts, pkgPath, fm, files.FS, files.Dir, lDelim, rDelim, meta, filePaths...)
 				return t, lDelim, rDelim, err
 			case "Parse":
 				if len(call.Args) != 1 {
 					return nil, lDelim, rDelim, wrapWithFilename(workingDirectory, fileSet, call.Lparen, fmt.Errorf("expected exactly one string literal argument"))
 				}
-				if meta != nil {
-					if bl, ok := call.Args[0].(*ast.BasicLit); ok {
-						meta.ParseCalls = append(meta.ParseCalls, bl)
-					}
-				}
 				sl, err := StringLiteralExpression(workingDirectory, fileSet, call.Args[0])
 				if err != nil {
 					return nil, lDelim, rDelim, err
 				}
-				t, err := ts.Parse(sl)
+				t, err := parseLiteral(ts, sl, call.Args[0], meta, fm, lDelim, rDelim)
 				return t, lDelim, rDelim, err
 			case "Funcs":
-				if err := evaluateFuncMap(workingDirectory, typesInfo, pkg, fileSet, call, fm, funcTypeMaps); err != nil {
+				if err := evaluateFuncMap(workingDirectory, typesInfo, pkg, fileSet, call, fm, funcTypeMaps, providers); err != nil {
 					return nil, lDelim, rDelim, err
 				}
 				return ts.Funcs(fm), lDelim, rDelim, nil
@@ -114,7 +355,7 @@ func EvaluateTemplateSelector(ts Template, pkg *types.Package, typesInfo *types.
 			if len(call.Args) != 1 {
 				return nil, lDelim, rDelim, wrapWithFilename(workingDirectory, fileSet, call.Lparen, fmt.Errorf("expected exactly one argument %s got %d", astgen.Format(sel.X), len(call.Args)))
 			}
-			return EvaluateTemplateSelector(ts, pkg, typesInfo, call.Args[0], workingDirectory, templatesVariable, rDelim, lDelim, fileSet, files, embeddedPaths, funcTypeMaps, fm, meta)
+			return EvaluateTemplateSelector(ts, pkg, typesInfo, call.Args[0], workingDirectory, templatesVariable, rDelim, lDelim, fileSet, embeds, funcTypeMaps, providers, variables, fm, meta)
 		case "New":
 			if len(call.Args) != 1 {
 				return nil, lDelim, rDelim, wrapWithFilename(workingDirectory, fileSet, call.Lparen, fmt.Errorf("expected exactly one string literal argument"))
@@ -125,24 +366,40 @@ func EvaluateTemplateSelector(ts Template, pkg *types.Package, typesInfo *types.
 			}
 			return NewTemplate(pkgPath, templateNames[0]), lDelim, rDelim, nil
 		case "ParseFS":
-			filePaths, err := evaluateCallParseFilesArgs(workingDirectory, fileSet, call, files, embeddedPaths)
+			files, filePaths, err := evaluateCallParseFilesArgs(workingDirectory, fileSet, call, embeds)
 			if err != nil {
 				return nil, lDelim, rDelim, err
 			}
 			if meta != nil {
-				meta.EmbedFilePaths = append(meta.EmbedFilePaths, filePaths...)
+				meta.EmbedFilePaths = append(meta.EmbedFilePaths, joinFilePaths(files.Dir, filePaths...)...)
 			}
-			t, err := parseFiles(nil, pkgPath, fm, lDelim, rDelim, filePaths...)
+			t, err := parseFiles(nil, pkgPath, fm, files.FS, files.Dir, lDelim, rDelim, meta, filePaths...)
 			return t, lDelim, rDelim, err
 		default:
 			return nil, lDelim, rDelim, wrapWithFilename(workingDirectory, fileSet, call.Fun.Pos(), fmt.Errorf("unsupported function %s", sel.Sel.Name))
 		}
 	case *ast.CallExpr:
-		up, upLDelim, upRDelim, err := EvaluateTemplateSelector(ts, pkg, typesInfo, sel.X, workingDirectory, templatesVariable, rDelim, lDelim, fileSet, files, embeddedPaths, funcTypeMaps, fm, meta)
+		up, upLDelim, upRDelim, err := EvaluateTemplateSelector(ts, pkg, typesInfo, sel.X, workingDirectory, templatesVariable, rDelim, lDelim, fileSet, embeds, funcTypeMaps, providers, variables, fm, meta)
 		if err != nil {
 			return nil, lDelim, rDelim, err
 		}
 		switch sel.Sel.Name {
+		case "Clone":
+			t, err := cloneTemplate(up, meta, meta)
+			return t, upLDelim, upRDelim, err
+		case "Lookup":
+			if len(call.Args) != 1 {
+				return nil, upLDelim, upRDelim, wrapWithFilename(workingDirectory, fileSet, call.Lparen, fmt.Errorf("expected exactly one string literal argument"))
+			}
+			name, err := StringLiteralExpression(workingDirectory, fileSet, call.Args[0])
+			if err != nil {
+				return nil, upLDelim, upRDelim, err
+			}
+			t := up.Lookup(name)
+			if t == nil {
+				return nil, upLDelim, upRDelim, wrapWithFilename(workingDirectory, fileSet, call.Args[0].Pos(), fmt.Errorf("template %q not defined", name))
+			}
+			return t, upLDelim, upRDelim, nil
 		case "Delims":
 			if len(call.Args) != 2 {
 				return nil, upLDelim, upRDelim, wrapWithFilename(workingDirectory, fileSet, call.Lparen, fmt.Errorf("expected exactly two string literal arguments"))
@@ -156,16 +413,11 @@ func EvaluateTemplateSelector(ts Template, pkg *types.Package, typesInfo *types.
 			if len(call.Args) != 1 {
 				return nil, upLDelim, upRDelim, wrapWithFilename(workingDirectory, fileSet, call.Lparen, fmt.Errorf("expected exactly one string literal argument"))
 			}
-			if meta != nil {
-				if bl, ok := call.Args[0].(*ast.BasicLit); ok {
-					meta.ParseCalls = append(meta.ParseCalls, bl)
-				}
-			}
 			sl, err := StringLiteralExpression(workingDirectory, fileSet, call.Args[0])
 			if err != nil {
 				return nil, upLDelim, upRDelim, err
 			}
-			t, err := up.Parse(sl)
+			t, err := parseLiteral(up, sl, call.Args[0], meta, fm, upLDelim, upRDelim)
 			return t, upLDelim, upRDelim, err
 		case "New":
 			if len(call.Args) != 1 {
@@ -177,14 +429,14 @@ func EvaluateTemplateSelector(ts Template, pkg *types.Package, typesInfo *types.
 			}
 			return up.New(templateNames[0]), upLDelim, upRDelim, nil
 		case "ParseFS":
-			filePaths, err := evaluateCallParseFilesArgs(workingDirectory, fileSet, call, files, embeddedPaths)
+			files, filePaths, err := evaluateCallParseFilesArgs(workingDirectory, fileSet, call, embeds)
 			if err != nil {
 				return nil, upLDelim, upRDelim, err
 			}
 			if meta != nil {
-				meta.EmbedFilePaths = append(meta.EmbedFilePaths, filePaths...)
+				meta.EmbedFilePaths = append(meta.EmbedFilePaths, joinFilePaths(files.Dir, filePaths...)...)
 			}
-			t, err := parseFiles(up, "", fm, upLDelim, upRDelim, filePaths...)
+			t, err := parseFiles(up, "", fm, files.FS, files.Dir, upLDelim, upRDelim, meta, filePaths...)
 			return t, upLDelim, upRDelim, err
 		case "Option":
 			list, err := StringLiteralExpressionList(workingDirectory, fileSet, call.Args)
@@ -193,7 +445,7 @@ func EvaluateTemplateSelector(ts Template, pkg *types.Package, typesInfo *types.
 			}
 			return up.Option(list...), upLDelim, upRDelim, nil
 		case "Funcs":
-			if err := evaluateFuncMap(workingDirectory, typesInfo, pkg, fileSet, call, fm, funcTypeMaps); err != nil {
+			if err := evaluateFuncMap(workingDirectory, typesInfo, pkg, fileSet, call, fm, funcTypeMaps, providers); err != nil {
 				return nil, upLDelim, upRDelim, err
 			}
 			return up.Funcs(fm), upLDelim, upRDelim, nil
@@ -203,6 +455,63 @@ func EvaluateTemplateSelector(ts Template, pkg *types.Package, typesInfo *types.
 	}
 }
 
+// TemplateVariables returns the templates a variable used as a receiver
+// holds, such as base in base.Clone(), along with their metadata. It
+// returns a nil Template for variables it does not know.
+type TemplateVariables func(obj types.Object) (Template, *TemplateMetadata, error)
+
+func (variables TemplateVariables) lookup(typesInfo *types.Info, ident *ast.Ident) (Template, *TemplateMetadata, error) {
+	if variables == nil || typesInfo == nil {
+		return nil, nil, nil
+	}
+	obj := typesInfo.Uses[ident]
+	if obj == nil {
+		return nil, nil, nil
+	}
+	return variables(obj)
+}
+
+// cloneTemplate clones t, whose trees from describes. The copies are an
+// independent template set whose definitions later ones may replace, so
+// meta records them as overridable, along with the literals they were
+// parsed from.
+func cloneTemplate(t Template, from, meta *TemplateMetadata) (Template, error) {
+	clone, err := t.Clone()
+	if err != nil || meta == nil {
+		return clone, err
+	}
+	for _, name := range clone.TreeNames() {
+		tree, _ := clone.FindTree(name)
+		if tree == nil {
+			continue
+		}
+		if meta.Overridable == nil {
+			meta.Overridable = make(map[*parse.Tree]bool)
+		}
+		meta.Overridable[tree] = true
+		if from == nil {
+			continue
+		}
+		original, _ := t.FindTree(name)
+		if from.ParseTrees[original] != nil {
+			if meta.ParseTrees == nil {
+				meta.ParseTrees = make(map[*parse.Tree]*ast.BasicLit)
+			}
+			meta.ParseTrees[tree] = from.ParseTrees[original]
+		}
+		if src, ok := from.Sources[original]; ok {
+			if meta.Sources == nil {
+				meta.Sources = make(map[*parse.Tree]string)
+			}
+			meta.Sources[tree] = src
+		}
+	}
+	if from != nil && from != meta {
+		meta.EmbedFilePaths = append(meta.EmbedFilePaths, from.EmbedFilePaths...)
+	}
+	return clone, nil
+}
+
 // templatePkgPath extracts the import path ("html/template" or "text/template")
 // from an AST identifier that refers to a template package.
 func templatePkgPath(info *types.Info, ident *ast.Ident) string {
@@ -255,7 +564,8 @@ func IsTemplateMethod(typesInfo *types.Info, sel *ast.SelectorExpr) bool {
 
 // FindModificationReceiver unwraps template.Must and returns the types.Object
 // of the variable receiver for a method call like ts.ParseFS(...) or
-// template.Must(ts.ParseFS(...)). Returns nil if no variable receiver is found.
+// template.Must(ts.ParseFS(...)). Returns nil if no variable receiver is found,
+// or for Clone and Lookup, which leave the receiver as it is.
 func FindModificationReceiver(expr *ast.CallExpr, typesInfo *types.Info) types.Object {
 	sel, ok := expr.Fun.(*ast.SelectorExpr)
 	if !ok {
@@ -270,7 +580,7 @@ func FindModificationReceiver(expr *ast.CallExpr, typesInfo *types.Info) types.O
 			}
 			return FindModificationReceiver(inner, typesInfo)
 		}
-		if IsTemplatePkgIdent(typesInfo, x) {
+		if IsTemplatePkgIdent(typesInfo, x) || sel.Sel.Name == "Clone" || sel.Sel.Name == "Lookup" {
 			return nil
 		}
 		return typesInfo.Uses[x]
@@ -305,17 +615,37 @@ func builtins() map[string]any {
 	}
 }
 
-func parseFiles(t Template, pkgPath string, fm map[string]any, leftDelim, rightDelim string, filenames ...string) (Template, error) {
+// parseFiles parses the files named by filenames, paths relative to dir,
+// reading them from fsys, which holds the files of dir. Each tree's
+// ParseName is the absolute path of its file. meta records the
+// definitions replacing earlier ones.
+func parseFiles(t Template, pkgPath string, fm map[string]any, fsys fs.FS, dir, leftDelim, rightDelim string, meta *TemplateMetadata, filenames ...string) (Template, error) {
 	if len(filenames) == 0 {
 		return nil, fmt.Errorf("template: no files named in call to ParseFiles")
 	}
 	for _, filename := range filenames {
 		templateName := filepath.Base(filename)
-		b, err := os.ReadFile(filename)
+		b, err := fs.ReadFile(fsys, filepath.ToSlash(filename))
 		if err != nil {
 			return nil, err
 		}
 		s := string(b)
+		// Comments are kept so the checker can read check: directives.
+		tree := parse.New(templateName)
+		tree.Mode = parse.ParseComments
+		trees := make(map[string]*parse.Tree)
+		if _, err := tree.Parse(s, leftDelim, rightDelim, trees, fm, builtins()); err != nil {
+			return nil, err
+		}
+		absoluteFilename, err := filepath.Abs(filepath.Join(dir, filename))
+		if err != nil {
+			return nil, err
+		}
+		for _, tree := range trees {
+			tree.ParseName = absoluteFilename
+		}
+		meta.recordDefinitions(t, s, rightDelim, absoluteFilename, trees)
+		meta.recordSources(s, trees)
 		var tmpl Template
 		if t == nil {
 			t = NewTemplate(pkgPath, templateName)
@@ -325,16 +655,7 @@ func parseFiles(t Template, pkgPath string, fm map[string]any, leftDelim, rightD
 		} else {
 			tmpl = t.New(templateName)
 		}
-		trees, err := parse.Parse(templateName, s, leftDelim, rightDelim, fm, builtins())
-		if err != nil {
-			return nil, err
-		}
-		absoluteFilename, err := filepath.Abs(filename)
-		if err != nil {
-			return nil, err
-		}
 		for _, tree := range trees {
-			tree.ParseName = absoluteFilename
 			if _, err = tmpl.AddParseTree(tree.Name, tree); err != nil {
 				return nil, err
 			}
@@ -343,11 +664,18 @@ func parseFiles(t Template, pkgPath string, fm map[string]any, leftDelim, rightD
 	return t, nil
 }
 
-func evaluateFuncMap(workingDirectory string, typesInfo *types.Info, pkg *types.Package, fileSet *token.FileSet, call *ast.CallExpr, fm map[string]any, funcTypesMap TemplateFunctions) error {
+func evaluateFuncMap(workingDirectory string, typesInfo *types.Info, pkg *types.Package, fileSet *token.FileSet, call *ast.CallExpr, fm map[string]any, funcTypesMap TemplateFunctions, providers FuncMapProviders) error {
 	if len(call.Args) != 1 {
 		return wrapWithFilename(workingDirectory, fileSet, call.Lparen, fmt.Errorf("expected exactly 1 template.FuncMap composite literal argument"))
 	}
 	arg := call.Args[0]
+	if functions, ok := providers.lookup(typesInfo, arg); ok {
+		for funcName, sig := range functions {
+			fm[funcName] = fmt.Sprintln
+			funcTypesMap[funcName] = sig
+		}
+		return nil
+	}
 	lit, ok := arg.(*ast.CompositeLit)
 	if !ok {
 		return wrapWithFilename(workingDirectory, fileSet, arg.Pos(), fmt.Errorf("expected a template.FuncMap composite literal got %s", astgen.Format(arg)))
@@ -405,146 +733,35 @@ func evaluateFuncMap(workingDirectory string, typesInfo *types.Info, pkg *types.
 	return nil
 }
 
-func evaluateCallParseFilesArgs(workingDirectory string, fileSet *token.FileSet, call *ast.CallExpr, files []*ast.File, embeddedPaths []string) ([]string, error) {
+// evaluateCallParseFilesArgs returns the embedded files a ParseFS call
+// reads, as paths relative to the directory of the package embedding them.
+func evaluateCallParseFilesArgs(workingDirectory string, fileSet *token.FileSet, call *ast.CallExpr, embeds *EmbeddedFiles) (*EmbeddedFiles, []string, error) {
 	if len(call.Args) < 1 {
-		return nil, wrapWithFilename(workingDirectory, fileSet, call.Lparen, fmt.Errorf("missing required arguments"))
+		return nil, nil, wrapWithFilename(workingDirectory, fileSet, call.Lparen, fmt.Errorf("missing required arguments"))
 	}
-	matches, err := embedFSFilePaths(workingDirectory, fileSet, files, call.Args[0], embeddedPaths)
+	dir, err := resolveEmbedDir(workingDirectory, fileSet, embeds, call.Args[0], nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	templateNames, err := StringLiteralExpressionList(workingDirectory, fileSet, call.Args[1:])
 	if err != nil {
-		return nil, err
-	}
-	filtered := matches[:0]
-	for _, ef := range matches {
-		for j, pattern := range templateNames {
-			match, err := filepath.Match(pattern, ef)
+		return nil, nil, err
+	}
+	// Like ParseFS, files are taken pattern by pattern, so later patterns'
+	// definitions replace earlier ones.
+	var filtered []string
+	for j, pattern := range templateNames {
+		for _, ef := range dir.paths {
+			match, err := path.Match(pattern, dir.rel(ef))
 			if err != nil {
-				return nil, wrapWithFilename(workingDirectory, fileSet, call.Args[j+1].Pos(), fmt.Errorf("bad pattern %q: %w", pattern, err))
+				return nil, nil, wrapWithFilename(workingDirectory, fileSet, call.Args[j+1].Pos(), fmt.Errorf("bad pattern %q: %w", pattern, err))
 			}
-			if !match {
-				continue
+			if match && !slices.Contains(filtered, ef) {
+				filtered = append(filtered, ef)
 			}
-			filtered = append(filtered, ef)
-			break
 		}
 	}
-	return joinFilePaths(workingDirectory, filtered...), nil
-}
-
-func embedFSFilePaths(dir string, fileSet *token.FileSet, files []*ast.File, exp ast.Expr, embeddedFiles []string) ([]string, error) {
-	varIdent, ok := exp.(*ast.Ident)
-	if !ok {
-		return nil, wrapWithFilename(dir, fileSet, exp.Pos(), fmt.Errorf("first argument to ParseFS must be an identifier"))
-	}
-	for _, decl := range astgen.IterateGenDecl(files, token.VAR) {
-		for _, s := range decl.Specs {
-			spec, ok := s.(*ast.ValueSpec)
-			if !ok || !slices.ContainsFunc(spec.Names, func(e *ast.Ident) bool { return e.Name == varIdent.Name }) {
-				continue
-			}
-			var comment strings.Builder
-			commentNode := readComments(&comment, decl.Doc, spec.Doc)
-			templateNames := parseTemplateNames(comment.String())
-			absMat, err := embeddedFilesMatchingTemplateNameList(dir, fileSet, commentNode, templateNames, embeddedFiles)
-			if err != nil {
-				return nil, err
-			}
-			return absMat, nil
-		}
-	}
-	return nil, wrapWithFilename(dir, fileSet, exp.Pos(), fmt.Errorf("variable %s not found", varIdent))
-}
-
-func embeddedFilesMatchingTemplateNameList(dir string, set *token.FileSet, comment ast.Node, templateNames, embeddedFiles []string) ([]string, error) {
-	var matches []string
-	for _, fp := range embeddedFiles {
-		for _, pattern := range templateNames {
-			pat := filepath.FromSlash(pattern)
-			if !strings.ContainsAny(pat, "*[]") {
-				prefix := filepath.FromSlash(pat + "/")
-				if strings.HasPrefix(fp, prefix) {
-					matches = append(matches, fp)
-					continue
-				}
-			}
-			if matched, err := filepath.Match(pat, fp); err != nil {
-				return nil, wrapWithFilename(dir, set, comment.Pos(), fmt.Errorf("embed comment malformed: %w", err))
-			} else if matched {
-				matches = append(matches, fp)
-			}
-		}
-	}
-	return slices.Clip(matches), nil
-}
-
-const goEmbedCommentPrefix = "//go:embed"
-
-func readComments(s *strings.Builder, groups ...*ast.CommentGroup) ast.Node {
-	var n ast.Node
-	for _, c := range groups {
-		if c == nil {
-			continue
-		}
-		for _, line := range c.List {
-			if !strings.HasPrefix(line.Text, goEmbedCommentPrefix) {
-				continue
-			}
-			s.WriteString(strings.TrimSpace(strings.TrimPrefix(line.Text, goEmbedCommentPrefix)))
-			s.WriteByte(' ')
-		}
-		n = c
-		break
-	}
-	return n
-}
-
-func parseTemplateNames(input string) []string {
-	// todo: refactor to use strconv.QuotedPrefix
-	var (
-		templateNames       []string
-		currentTemplateName strings.Builder
-		inQuote             = false
-		quoteChar           rune
-	)
-
-	for _, r := range input {
-		switch {
-		case r == '"' || r == '`':
-			if !inQuote {
-				inQuote = true
-				quoteChar = r
-				continue
-			}
-			if r != quoteChar {
-				currentTemplateName.WriteRune(r)
-				continue
-			}
-			templateNames = append(templateNames, currentTemplateName.String())
-			currentTemplateName.Reset()
-			inQuote = false
-		case unicode.IsSpace(r):
-			if inQuote {
-				currentTemplateName.WriteRune(r)
-				continue
-			}
-			if currentTemplateName.Len() > 0 {
-				templateNames = append(templateNames, currentTemplateName.String())
-				currentTemplateName.Reset()
-			}
-		default:
-			currentTemplateName.WriteRune(r)
-		}
-	}
-
-	// Import any remaining pattern
-	if currentTemplateName.Len() > 0 {
-		templateNames = append(templateNames, currentTemplateName.String())
-	}
-
-	return templateNames
+	return dir.files, filtered, nil
 }
 
 func joinFilePaths(wd string, rel ...string) []string {
@@ -569,6 +786,37 @@ func RelativeFilePaths(wd string, abs ...string) ([]string, error) {
 
 type TemplateFunctions map[string]*types.Signature
 
+// FuncMapProviders maps the package path qualified name of a function
+// returning a template.FuncMap, or of a variable holding one, such as
+// "example.com/app/views.Funcs", to the functions in that FuncMap. A Funcs
+// argument calling or naming a provider resolves to its functions.
+type FuncMapProviders map[string]TemplateFunctions
+
+// lookup returns the functions of the provider expr calls or names.
+func (providers FuncMapProviders) lookup(typesInfo *types.Info, expr ast.Expr) (TemplateFunctions, bool) {
+	if len(providers) == 0 || typesInfo == nil {
+		return nil, false
+	}
+	if call, ok := expr.(*ast.CallExpr); ok && len(call.Args) == 0 {
+		expr = call.Fun
+	}
+	var ident *ast.Ident
+	switch x := expr.(type) {
+	case *ast.Ident:
+		ident = x
+	case *ast.SelectorExpr:
+		ident = x.Sel
+	default:
+		return nil, false
+	}
+	obj := typesInfo.Uses[ident]
+	if obj == nil || obj.Pkg() == nil {
+		return nil, false
+	}
+	functions, ok := providers[obj.Pkg().Path()+"."+obj.Name()]
+	return functions, ok
+}
+
 func DefaultFunctions(pkg *types.Package) TemplateFunctions {
 	funcTypeMap := make(TemplateFunctions)
 	fmtPkg, ok := findPackage(pkg, "fmt")
@@ -34,6 +34,14 @@ func (h *htmlTemplate) Delims(left, right string) Template {
 	return &htmlTemplate{t: h.t.Delims(left, right)}
 }
 
+func (h *htmlTemplate) Clone() (Template, error) {
+	t, err := h.t.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return &htmlTemplate{t: t}, nil
+}
+
 func (h *htmlTemplate) Lookup(name string) Template {
 	t := h.t.Lookup(name)
 	if t == nil {
@@ -65,3 +73,13 @@ func (h *htmlTemplate) FindTree(name string) (*parse.Tree, bool) {
 	}
 	return t.Tree, true
 }
+
+func (h *htmlTemplate) TreeNames() []string {
+	var names []string
+	for _, t := range h.t.Templates() {
+		if t.Tree != nil {
+			names = append(names, t.Name())
+		}
+	}
+	return names
+}
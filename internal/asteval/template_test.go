@@ -1,9 +1,17 @@
 package asteval
 
 import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
 	"go/token"
 	"go/types"
+	"path/filepath"
+	"slices"
 	"testing"
+	"testing/fstest"
+
+	"golang.org/x/tools/txtar"
 )
 
 func TestDefaultFunctions(t *testing.T) {
@@ -53,3 +61,185 @@ func TestDefaultFunctions(t *testing.T) {
 		}
 	})
 }
+
+func TestEvaluateTemplateSelector_fs(t *testing.T) {
+	// Templates are read from an fs.FS, so fixtures need no temporary
+	// directory: the Go file is type-checked from the archive and the
+	// template files are served from memory.
+	fset := token.NewFileSet()
+	imports := importer.ForCompiler(fset, "source", nil)
+	for _, tt := range []struct {
+		archive  string
+		variable string
+		want     []string
+	}{
+		{archive: "template_ParseFS.txtar", variable: "templates", want: []string{"create", "form.gohtml", "home", "index.gohtml", "update"}},
+		{archive: "template_ParseFS.txtar", variable: "templatesHTML", want: []string{"console_log", "create", "form.gohtml", "home", "index.gohtml", "script.html", "update"}},
+		{archive: "template_ParseFS.txtar", variable: "templatesGoHTML", want: []string{"create", "form.gohtml", "home", "index.gohtml", "update"}},
+		{archive: "assets_dir.txtar", variable: "templates", want: []string{"create", "form.gohtml", "home", "index.gohtml", "update"}},
+		{archive: "assets_sub.txtar", variable: "templates", want: []string{"create", "form.gohtml", "home", "index.gohtml", "update"}},
+		{archive: "assets_sub.txtar", variable: "partials", want: []string{"nav", "nav.gohtml"}},
+		{archive: "assets_sub.txtar", variable: "root", want: []string{"nav", "nav.gohtml"}},
+		{archive: "embed_directives.txtar", variable: "templates", want: []string{".draft.gohtml", "_nav.gohtml", "base.gohtml", "index.gohtml"}},
+	} {
+		t.Run(tt.archive+"/"+tt.variable, func(t *testing.T) {
+			archive, err := txtar.ParseFile(filepath.Join("testdata", "template", tt.archive))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fsys := make(fstest.MapFS)
+			var (
+				files         []*ast.File
+				embeddedPaths []string
+			)
+			for _, file := range archive.Files {
+				if filepath.Ext(file.Name) != ".go" {
+					fsys[file.Name] = &fstest.MapFile{Data: file.Data}
+					embeddedPaths = append(embeddedPaths, filepath.FromSlash(file.Name))
+					continue
+				}
+				f, err := parser.ParseFile(fset, file.Name, file.Data, parser.ParseComments)
+				if err != nil {
+					t.Fatal(err)
+				}
+				files = append(files, f)
+			}
+			info := &types.Info{
+				Types: make(map[ast.Expr]types.TypeAndValue),
+				Defs:  make(map[*ast.Ident]types.Object),
+				Uses:  make(map[*ast.Ident]types.Object),
+			}
+			config := types.Config{
+				Importer: imports,
+				// Some fixtures reference undeclared names on purpose.
+				Error: func(error) {},
+			}
+			pkg, _ := config.Check("example.com/app", fset, files, info)
+
+			var expr ast.Expr
+			for _, f := range files {
+				ast.Inspect(f, func(node ast.Node) bool {
+					if spec, ok := node.(*ast.ValueSpec); ok && spec.Names[0].Name == tt.variable {
+						expr = spec.Values[0]
+					}
+					return expr == nil
+				})
+			}
+			if expr == nil {
+				t.Fatalf("variable %s not found", tt.variable)
+			}
+
+			embeds := &EmbeddedFiles{Dir: ".", Syntax: files, TypesInfo: info, Paths: embeddedPaths, FS: fsys}
+			ts, _, _, err := EvaluateTemplateSelector(nil, pkg, info, expr, ".", tt.variable, "", "", fset, embeds, DefaultFunctions(pkg), nil, nil, make(map[string]any), &TemplateMetadata{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ts.TreeNames()
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("TreeNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbeds(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, name string
+		want          bool
+	}{
+		{pattern: "index.gohtml", name: "index.gohtml", want: true},
+		{pattern: "*.gohtml", name: "pages/index.gohtml", want: false},
+		{pattern: "pages/*.gohtml", name: "pages/.draft.gohtml", want: true},
+		{pattern: "pages", name: "pages/index.gohtml", want: true},
+		{pattern: "pages", name: "pages/admin/index.gohtml", want: true},
+		{pattern: "pages", name: "pages/.draft.gohtml", want: false},
+		{pattern: "pages", name: "pages/_partials/nav.gohtml", want: false},
+		{pattern: "all:pages", name: "pages/_partials/nav.gohtml", want: true},
+		{pattern: "_pages", name: "_pages/index.gohtml", want: true},
+		{pattern: "p*", name: "pages/index.gohtml", want: true},
+		{pattern: "pages/index.gohtml", name: "pages", want: false},
+	} {
+		if got := embeds(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("embeds(%q, %q) = %t, want %t", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEmbedPatterns(t *testing.T) {
+	for _, tt := range []struct {
+		directive string
+		want      []string
+		wantErr   bool
+	}{
+		{directive: "//go:embed a b", want: []string{"a", "b"}},
+		{directive: "//go:embed\t\"with space\" `raw` all:c", want: []string{"with space", "raw", "all:c"}},
+		{directive: "//go:embed \"a\"b", wantErr: true},
+		{directive: "//go:embed \"unterminated", wantErr: true},
+	} {
+		got, err := embedPatterns(tt.directive)
+		if (err != nil) != tt.wantErr || !slices.Equal(got, tt.want) {
+			t.Errorf("embedPatterns(%q) = %q, %v; want %q, error %t", tt.directive, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestRecordDefinitions(t *testing.T) {
+	meta := &TemplateMetadata{}
+	ts := NewTemplate("text/template", "page")
+	for _, tt := range []struct {
+		text, leftDelim, rightDelim string
+	}{
+		{text: `{{block "content" .}}default{{end}}{{define "footer"}}one{{end}}`},
+		{text: `{{define "content"}}page{{end}}{{define "footer"}}two{{end}}{{define "empty"}}{{end}}`},
+		{text: `{{define "empty"}} {{end}}`},
+		{text: `{{- block "side" (printf "%s}}" .) -}}  default {{- end}}{{template "main" .}}{{define "main"}}one{{end}}`},
+		{text: `[[block "nav" .]][[end]][[template "aside" "]]"]]` + "\n" + `[[define "aside"]]one[[end]]`, leftDelim: "[[", rightDelim: "]]"},
+		{text: `{{define "side"}}page{{end}}{{define "main"}}two{{end}}{{define "nav"}}page{{end}}{{define "aside"}}two{{end}}`},
+	} {
+		var err error
+		ts, err = parseLiteral(ts, tt.text, nil, meta, make(map[string]any), tt.leftDelim, tt.rightDelim)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	for _, r := range meta.Redefinitions {
+		got = append(got, r.Tree.Name)
+	}
+	if want := []string{"footer", "page", "page", "aside", "main"}; !slices.Equal(got, want) {
+		t.Errorf("redefined %v, want %v", got, want)
+	}
+}
+
+func TestCloneTemplate(t *testing.T) {
+	for _, templatePkg := range []string{"html/template", "text/template"} {
+		t.Run(templatePkg, func(t *testing.T) {
+			meta := &TemplateMetadata{}
+			base, err := parseLiteral(NewTemplate(templatePkg, "layout"), `<main>{{block "content" .}}{{.Title}}{{end}}</main>{{define "nav"}}<a>{{end}}`, nil, meta, make(map[string]any), "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			pageMeta := &TemplateMetadata{}
+			page, err := cloneTemplate(base, meta, pageMeta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			page, err = parseLiteral(page, `{{define "content"}}{{.Body}}{{end}}{{define "nav"}}<b>{{end}}`, nil, pageMeta, make(map[string]any), "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pageMeta.Redefinitions) != 0 {
+				t.Errorf("overriding cloned definitions recorded %d redefinitions, want none", len(pageMeta.Redefinitions))
+			}
+			baseContent, _ := base.FindTree("content")
+			pageContent, _ := page.FindTree("content")
+			if got, want := baseContent.Root.String(), "{{.Title}}"; got != want {
+				t.Errorf("base content = %q, want %q", got, want)
+			}
+			if got, want := pageContent.Root.String(), "{{.Body}}"; got != want {
+				t.Errorf("page content = %q, want %q", got, want)
+			}
+		})
+	}
+}
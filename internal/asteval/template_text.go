@@ -34,6 +34,14 @@ func (s *textTemplate) Delims(left, right string) Template {
 	return &textTemplate{t: s.t.Delims(left, right)}
 }
 
+func (s *textTemplate) Clone() (Template, error) {
+	t, err := s.t.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return &textTemplate{t: t}, nil
+}
+
 func (s *textTemplate) Lookup(name string) Template {
 	t := s.t.Lookup(name)
 	if t == nil {
@@ -65,3 +73,13 @@ func (s *textTemplate) FindTree(name string) (*parse.Tree, bool) {
 	}
 	return t.Tree, true
 }
+
+func (s *textTemplate) TreeNames() []string {
+	var names []string
+	for _, t := range s.t.Templates() {
+		if t.Tree != nil {
+			names = append(names, t.Name())
+		}
+	}
+	return names
+}
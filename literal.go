@@ -0,0 +1,84 @@
+package check
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+	"text/template/parse"
+	"unicode/utf8"
+)
+
+// locateInLiterals moves Start and End of each error in err that was found
+// in a template parsed from a Go string literal into the Go file holding
+// the literal, and makes the error's message report that position.
+// literals maps the trees parsed from literals to the literal.
+func locateInLiterals(err error, fset *token.FileSet, literals map[*parse.Tree]*ast.BasicLit) {
+	checkErr, ok := err.(*Error)
+	if !ok || len(literals) == 0 {
+		return
+	}
+	for e := range checkErr.All {
+		lit, ok := literals[e.Tree]
+		if !ok || !e.Start.IsValid() || e.inLiteral {
+			continue
+		}
+		offsets := literalOffsets(lit)
+		if offsets == nil {
+			continue
+		}
+		e.Start = literalPosition(fset, lit, offsets, e.Start.Offset)
+		e.End = literalPosition(fset, lit, offsets, e.End.Offset)
+		e.inLiteral = true
+	}
+}
+
+// literalOffsets maps each byte of the value of the string literal lit to
+// its index in lit.Value; a final entry maps the end of the value to the
+// closing quote. Every byte an escape sequence decodes to maps to the start
+// of the escape. It returns nil if lit is not a valid string literal.
+func literalOffsets(lit *ast.BasicLit) []int {
+	source := lit.Value
+	if lit.Kind != token.STRING || len(source) < 2 {
+		return nil
+	}
+	closing := len(source) - 1
+	offsets := make([]int, 0, len(source))
+	if source[0] == '`' {
+		for i := 1; i <= closing; i++ {
+			offsets = append(offsets, i)
+		}
+		return offsets
+	}
+	for rest := source[1:closing]; len(rest) > 0; {
+		at := closing - len(rest)
+		value, multibyte, tail, err := strconv.UnquoteChar(rest, '"')
+		if err != nil {
+			return nil
+		}
+		size := 1
+		if multibyte {
+			size = utf8.RuneLen(value)
+		}
+		for range size {
+			offsets = append(offsets, at)
+		}
+		rest = tail
+	}
+	return append(offsets, closing)
+}
+
+// literalPosition returns the Go source position of offset, a byte offset
+// in the value of lit. The scanner drops carriage returns from a raw
+// string's lit.Value, so an index past a newline is located by line and
+// column rather than by adding it to lit.Pos.
+func literalPosition(fset *token.FileSet, lit *ast.BasicLit, offsets []int, offset int) token.Position {
+	i := offsets[min(max(offset, 0), len(offsets)-1)]
+	newline := strings.LastIndexByte(lit.Value[:i], '\n')
+	if newline < 0 {
+		return fset.Position(lit.Pos() + token.Pos(i))
+	}
+	file := fset.File(lit.Pos())
+	line := fset.Position(lit.Pos()).Line + strings.Count(lit.Value[:i], "\n")
+	return fset.Position(file.LineStart(line) + token.Pos(i-newline-1))
+}
@@ -0,0 +1,46 @@
+package check
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLiteralPosition(t *testing.T) {
+	for _, tt := range []struct {
+		Name, Source string
+		Line, Column int
+	}{
+		{Name: "interpreted", Source: "package p\n\nvar _ = \"<p>{{.X}}\"\n", Line: 3, Column: 15},
+		{Name: "escapes", Source: "package p\n\nvar _ = \"\\t\\x41é\\u00e9\\n{{.X}}\"\n", Line: 3, Column: 28},
+		{Name: "raw", Source: "package p\n\nvar _ = `<p>\n\t{{.X}}`\n", Line: 4, Column: 4},
+		{Name: "raw with carriage returns", Source: "package p\r\n\r\nvar _ = `<p>\r\n\r\n\t{{.X}}`\r\n", Line: 5, Column: 4},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, "p.go", tt.Source, 0)
+			require.NoError(t, err)
+			var lit *ast.BasicLit
+			ast.Inspect(file, func(node ast.Node) bool {
+				if bl, ok := node.(*ast.BasicLit); ok {
+					lit = bl
+				}
+				return lit == nil
+			})
+			value, err := strconv.Unquote(lit.Value)
+			require.NoError(t, err)
+
+			offsets := literalOffsets(lit)
+			require.Len(t, offsets, len(value)+1)
+			pos := literalPosition(fset, lit, offsets, strings.Index(value, ".X"))
+			require.Equal(t, tt.Line, pos.Line)
+			require.Equal(t, tt.Column, pos.Column)
+			require.Equal(t, ".X", tt.Source[pos.Offset:pos.Offset+2])
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package check
+
+import (
+	"go/types"
+	"strings"
+	"text/template/parse"
+)
+
+// nonNilComment starts a template comment listing paths the author asserts
+// are non-nil: {{/* check:nonnil .User.Profile $u */}}.
+const nonNilComment = "check:nonnil"
+
+// checkNilReceiver reports selecting obj through receiver, the value at
+// the path formed by n's root and idents, when that value may be nil. A
+// nil pointer still has the methods of its pointer type, so only fields
+// are reported for pointers; a nil interface has none.
+func (s *scope) checkNilReceiver(tree *parse.Tree, n parse.Node, idents []string, receiver types.Type, obj types.Object) {
+	root, ok := nodeRoot(n)
+	if !ok {
+		return
+	}
+	switch receiver.Underlying().(type) {
+	case *types.Pointer:
+		if _, isField := obj.(*types.Var); !isField {
+			return
+		}
+	case *types.Interface:
+	default:
+		return
+	}
+	path := joinPath(root, idents)
+	if s.isNonNil(path) {
+		return
+	}
+	s.report(newError(ErrorTypeNilPointer, tree, n, "nil pointer evaluating %s.%s: %s is not guarded by {{with}} or {{if}}", receiver, obj.Name(), path).withX(receiver))
+}
+
+// nodeRoot returns the root of the paths through n: dot for a field, the
+// variable's name for a variable. Chains on parenthesized pipelines are not
+// tracked.
+func nodeRoot(n parse.Node) (string, bool) {
+	switch n := n.(type) {
+	case *parse.FieldNode:
+		return ".", true
+	case *parse.VariableNode:
+		return n.Ident[0], true
+	default:
+		return "", false
+	}
+}
+
+// joinPath returns the path selecting idents from root.
+func joinPath(root string, idents []string) string {
+	switch {
+	case len(idents) == 0:
+		return root
+	case root == ".":
+		return "." + strings.Join(idents, ".")
+	default:
+		return root + "." + strings.Join(idents, ".")
+	}
+}
+
+// nodePath returns the path a dot, field or variable node evaluates.
+func nodePath(n parse.Node) (string, bool) {
+	switch n := n.(type) {
+	case *parse.DotNode:
+		return ".", true
+	case *parse.FieldNode:
+		return joinPath(".", n.Ident), true
+	case *parse.VariableNode:
+		return joinPath(n.Ident[0], n.Ident[1:]), true
+	default:
+		return "", false
+	}
+}
+
+// pipePath returns the path a pipeline evaluates when it is a single
+// dot, field or variable.
+func pipePath(pipe *parse.PipeNode) (string, bool) {
+	if pipe == nil || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return "", false
+	}
+	return nodePath(pipe.Cmds[0].Args[0])
+}
+
+// guardPaths returns the paths that are non-nil when pipe is true: the
+// path it evaluates, each operand of an {{and}}, and the variables it
+// declares.
+func guardPaths(pipe *parse.PipeNode) []string {
+	if pipe == nil {
+		return nil
+	}
+	var paths []string
+	for _, decl := range pipe.Decl {
+		paths = append(paths, decl.Ident[0])
+	}
+	if path, ok := pipePath(pipe); ok {
+		return append(paths, path)
+	}
+	if len(pipe.Cmds) != 1 {
+		return paths
+	}
+	args := pipe.Cmds[0].Args
+	if ident, ok := args[0].(*parse.IdentifierNode); ok && ident.Ident == "and" {
+		for _, arg := range args[1:] {
+			if path, ok := nodePath(arg); ok {
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths
+}
+
+// negatedGuardPaths returns the paths that are non-nil when pipe is false,
+// as in the else branch of {{if not .User}}.
+func negatedGuardPaths(pipe *parse.PipeNode) []string {
+	if pipe == nil || len(pipe.Cmds) != 1 {
+		return nil
+	}
+	args := pipe.Cmds[0].Args
+	if ident, ok := args[0].(*parse.IdentifierNode); !ok || ident.Ident != "not" || len(args) != 2 {
+		return nil
+	}
+	if path, ok := nodePath(args[1]); ok {
+		return []string{path}
+	}
+	return nil
+}
+
+// isDotPath reports whether path starts at dot rather than at a variable.
+func isDotPath(path string) bool {
+	return strings.HasPrefix(path, ".")
+}
+
+// isNonNil reports whether the value at path is known to be non-nil.
+func (s *scope) isNonNil(path string) bool {
+	return path == "." || path == "$" || s.nonNil[path]
+}
+
+// markNonNil records that the values at paths, and so every value on the
+// way to them, are non-nil.
+func (s *scope) markNonNil(paths ...string) {
+	for _, path := range paths {
+		if s.nonNil == nil {
+			s.nonNil = make(map[string]bool)
+		}
+		s.nonNil[path] = true
+		for i := len(path) - 1; i > 0; i-- {
+			if path[i] == '.' {
+				s.nonNil[path[:i]] = true
+			}
+		}
+	}
+}
+
+// forgetNonNil drops the guards on root and the paths through it, when
+// root is reassigned or, for dot, rebound.
+func (s *scope) forgetNonNil(root string) {
+	for path := range s.nonNil {
+		if path == root || strings.HasPrefix(path, root+".") || (root == "." && isDotPath(path)) {
+			delete(s.nonNil, path)
+		}
+	}
+}
+
+// checkCommentNode applies a check:nonnil comment.
+func (s *scope) checkCommentNode(n *parse.CommentNode) {
+	fields := commentFields(n)
+	if len(fields) == 0 || fields[0] != nonNilComment {
+		return
+	}
+	s.markNonNil(fields[1:]...)
+}
@@ -1,11 +1,16 @@
 package check
 
 import (
+	"cmp"
 	"fmt"
 	"go/ast"
 	"go/token"
 	"go/types"
+	"io/fs"
+	"maps"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"text/template/parse"
 
 	"golang.org/x/tools/go/packages"
@@ -16,127 +21,435 @@ import (
 
 type pendingCall struct {
 	call         *ast.CallExpr
-	receiverObj  types.Object
+	receiver     receiver
 	templateName string
 	dataType     types.Type
 }
 
+// receiver identifies the templates an ExecuteTemplate call executes: those
+// a variable holds, or those of a map variable's element at a constant key,
+// as in pages["index"].ExecuteTemplate.
+type receiver struct {
+	obj types.Object
+
+	// key is the quoted map key, empty for the variable itself.
+	key string
+}
+
+// compareReceivers orders receivers by declaration position, then key.
+func compareReceivers(a, b receiver) int {
+	return cmp.Or(cmp.Compare(a.obj.Pos(), b.obj.Pos()), cmp.Compare(a.key, b.key))
+}
+
 type resolvedTemplate struct {
 	templates asteval.Template
 	functions asteval.TemplateFunctions
 	metadata  *asteval.TemplateMetadata
+
+	// funcs holds the functions Funcs calls added, which later Parse and
+	// ParseFS calls on the same variable parse with.
+	funcs map[string]any
 }
 
 type ExecuteTemplateNodeInspectorFunc func(node *ast.CallExpr, t *parse.Tree, tp types.Type)
 
+// UnresolvedCallInspectorFunc is called with an ExecuteTemplate call left
+// unchecked because the templates it executes could not be resolved.
+type UnresolvedCallInspectorFunc func(node *ast.CallExpr)
+
 // Package discovers all .ExecuteTemplate calls in the given package,
 // resolves receiver variables to their template construction chains,
 // and type-checks each call.
 //
 // ExecuteTemplate must be called with a string literal for the second parameter.
 //
+// Errors are suppressed by check:ignore directives naming their
+// ErrorType.String slugs: a template comment such as
+// {{/* check:ignore field-or-method-not-found */}} covers the next action,
+// or the whole template when it comes first, and a //check:ignore line
+// comment ending an ExecuteTemplate call's line, or alone on the line
+// above it, covers every error found checking the call. A directive type
+// that suppresses nothing is reported as an ErrorTypeUnusedSuppression
+// warning.
+//
 // A non-nil result is a *Error tree; see Execute for how to walk it.
 func Package(pkg *packages.Package, inspectCall ExecuteTemplateNodeInspectorFunc, inspectTemplate TemplateNodeInspectorFunc) error {
-	pending, receivers := findExecuteCalls(pkg)
-	resolved, resolveErrs := resolveTemplates(pkg, receivers)
-	callErr := checkCalls(pkg, pending, resolved, inspectCall, inspectTemplate)
-	return joinErrors(nil, nil, append(resolveErrs, callErr)...)
+	config := PackageConfig{
+		InspectCall:     inspectCall,
+		InspectTemplate: inspectTemplate,
+	}
+	return config.Check(pkg)
+}
+
+// PackageConfig configures how Check type-checks the ExecuteTemplate calls
+// in a package. The zero value checks the same way Package does.
+type PackageConfig struct {
+	InspectCall     ExecuteTemplateNodeInspectorFunc
+	InspectTemplate TemplateNodeInspectorFunc
+
+	// InspectUnresolved is called, in source order, with each
+	// ExecuteTemplate call whose receiver is not a variable or map
+	// element with a constant key holding templates resolved from the
+	// package, such as pages[name], a function parameter, or a variable
+	// assigned more than one set of templates.
+	InspectUnresolved UnresolvedCallInspectorFunc
+
+	// Sources, when non-nil, is given the text each template tree checked
+	// was parsed from, so NodeRange can locate the nodes passed to
+	// InspectTemplate and InspectUnchecked by line and column.
+	Sources map[*parse.Tree]string
+
+	// Lenient and InspectUnchecked set Global.Lenient and
+	// Global.InspectUncheckedNode for every call checked.
+	Lenient          bool
+	InspectUnchecked UncheckedNodeInspectorFunc
+
+	// NilPointers sets Global.NilPointers for every call checked.
+	NilPointers bool
+
+	// Deprecations sets Global.Deprecations for every call checked.
+	Deprecations bool
+
+	// Overlay holds the contents of Go and template files that replace,
+	// or are missing from, the disk, such as unsaved editor buffers. It is
+	// keyed by absolute path; pass the packages.Config.Overlay the package
+	// was loaded with. It sets Global.Overlay for every call checked.
+	Overlay map[string][]byte
+
+	// TemplateFS holds the files of the package directory, which
+	// templates named by ParseFS are read from, such as an archive or an
+	// in-memory fixture. The files the package embeds are those of
+	// TemplateFS its //go:embed patterns match, not those go build found
+	// on disk. Nil means the directory on disk with Overlay applied.
+	// Templates embedded in imported packages are always read from disk
+	// with Overlay applied.
+	TemplateFS fs.FS
+
+	// Renderers lists functions and methods, besides ExecuteTemplate,
+	// whose calls execute a template by name and are checked the same way.
+	Renderers []Renderer
+
+	// FuncMaps lists the package path qualified names of functions
+	// returning a template.FuncMap composite literal, or of variables
+	// initialized with one, such as "example.com/app/views.Funcs". A
+	// Funcs call passing one of them, rather than a literal, uses the
+	// functions in that literal. Imported providers need the package to
+	// be loaded with packages.NeedDeps.
+	FuncMaps []string
+}
+
+// Renderer describes a function or method that executes a template of a
+// package-level template variable by name, such as a helper wrapping
+// ExecuteTemplate. Calls to it must pass a string literal name.
+type Renderer struct {
+	// Func is the full name of the function or method, as
+	// types.Func.FullName formats it: "example.com/app.render" or
+	// "(*example.com/app.Server).Render".
+	Func string
+
+	// Templates names the package-level variable holding the templates
+	// Func executes, in the package being checked.
+	Templates string
+
+	// NameArg and DataArg are the indexes of the call arguments holding
+	// the template name and the data.
+	NameArg, DataArg int
+}
+
+// Check is Package with the options set on config.
+func (config PackageConfig) Check(pkg *packages.Package) error {
+	providers, providerErrs := funcMapProviders(pkg, config.FuncMaps)
+	pending, receivers, unresolved := findExecuteCalls(pkg, config.Renderers)
+	embeds, err := config.embeddedFiles(pkg)
+	if err != nil {
+		return err
+	}
+	resolved, unresolvedReceivers, resolveErrs := resolveTemplates(pkg, receivers, providers, embeds)
+	if config.InspectUnresolved != nil {
+		for _, p := range pending {
+			if unresolvedReceivers[p.receiver] {
+				unresolved = append(unresolved, p.call)
+			}
+		}
+		slices.SortFunc(unresolved, func(a, b *ast.CallExpr) int { return cmp.Compare(a.Pos(), b.Pos()) })
+		for _, call := range unresolved {
+			config.InspectUnresolved(call)
+		}
+	}
+	callErr := config.checkCalls(pkg, pending, resolved)
+	return joinErrors(nil, nil, slices.Concat(providerErrs, resolveErrs, []error{callErr})...)
+}
+
+// redefinitionErrors reports the definitions that replaced an earlier one
+// while resolving each template variable, giving both positions. Those a
+// suppression sups returns for the variable and redefining tree covers
+// are left out.
+func redefinitionErrors(pkg *packages.Package, resolved map[receiver]*resolvedTemplate, sups func(receiver, *parse.Tree) []*suppression) []error {
+	var errs []error
+	for _, r := range slices.SortedFunc(maps.Keys(resolved), compareReceivers) {
+		meta := resolved[r].metadata
+		for _, rd := range meta.Redefinitions {
+			previous := definitionError(pkg, meta, rd.Previous, rd.BaseName)
+			e := definitionError(pkg, meta, rd.Tree, rd.BaseName)
+			if rd.BaseName {
+				e.err = fmt.Errorf("template %q redefined by a file with the same base name; previous definition at %s", rd.Tree.Name, previous.Start)
+			} else {
+				e.err = fmt.Errorf("template %q redefined; previous definition at %s", rd.Tree.Name, previous.Start)
+			}
+			if suppress(e, sups(r, rd.Tree)) == nil {
+				continue
+			}
+			errs = append(errs, e)
+		}
+	}
+	return errs
+}
+
+// definitionError returns an error located where the definition of tree
+// starts: the start of its file for a file's template, else its first
+// node. A tree parsed from a Go string literal is located in the Go file.
+func definitionError(pkg *packages.Package, meta *asteval.TemplateMetadata, tree *parse.Tree, file bool) *Error {
+	offset := int(tree.Root.Pos)
+	if file {
+		offset = 0
+	}
+	e := &Error{Type: ErrorTypeTemplateRedefined, Tree: tree}
+	e.Start = treePosition(meta.Sources, tree, offset)
+	e.End = e.Start
+	locateInLiterals(e, pkg.Fset, meta.ParseTrees)
+	return e
 }
 
 // findExecuteCalls walks the package syntax looking for ExecuteTemplate calls
-// and returns the pending calls along with the set of receiver objects that
-// need template resolution.
-func findExecuteCalls(pkg *packages.Package) ([]pendingCall, map[types.Object]struct{}) {
-	var pending []pendingCall
-	receiverSet := make(map[types.Object]struct{})
+// and calls to renderers, and returns the pending calls along with the set
+// of receivers that need template resolution, and the ExecuteTemplate calls
+// on a receiver that names no variable or constant map element.
+func findExecuteCalls(pkg *packages.Package, renderers []Renderer) ([]pendingCall, map[receiver]struct{}, []*ast.CallExpr) {
+	var (
+		pending    []pendingCall
+		unresolved []*ast.CallExpr
+	)
+	receiverSet := make(map[receiver]struct{})
+
+	add := func(call *ast.CallExpr, r receiver, nameArg, dataArg ast.Expr) {
+		templateName, ok := asteval.BasicLiteralString(nameArg)
+		if !ok {
+			return
+		}
+		pending = append(pending, pendingCall{
+			call:         call,
+			receiver:     r,
+			templateName: templateName,
+			dataType:     pkg.TypesInfo.TypeOf(dataArg),
+		})
+		receiverSet[r] = struct{}{}
+	}
 
 	for _, file := range pkg.Syntax {
 		ast.Inspect(file, func(node ast.Node) bool {
 			call, ok := node.(*ast.CallExpr)
-			if !ok || len(call.Args) != 3 {
+			if !ok {
 				return true
 			}
-			sel, ok := call.Fun.(*ast.SelectorExpr)
-			if !ok || sel.Sel.Name != "ExecuteTemplate" {
+			if r, obj, ok := matchRenderer(pkg, renderers, call); ok {
+				add(call, receiver{obj: obj}, call.Args[r.NameArg], call.Args[r.DataArg])
 				return true
 			}
-			// Verify the method belongs to html/template or text/template.
-			if !asteval.IsTemplateMethod(pkg.TypesInfo, sel) {
+			if len(call.Args) != 3 {
 				return true
 			}
-			receiverIdent, ok := sel.X.(*ast.Ident)
-			if !ok {
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || sel.Sel.Name != "ExecuteTemplate" {
 				return true
 			}
-			obj := pkg.TypesInfo.Uses[receiverIdent]
-			if obj == nil {
+			// Verify the method belongs to html/template or text/template.
+			if !asteval.IsTemplateMethod(pkg.TypesInfo, sel) {
 				return true
 			}
-			templateName, ok := asteval.BasicLiteralString(call.Args[1])
+			r, ok := receiverOf(pkg.TypesInfo, sel.X)
 			if !ok {
+				unresolved = append(unresolved, call)
 				return true
 			}
-			dataType := pkg.TypesInfo.TypeOf(call.Args[2])
-			pending = append(pending, pendingCall{
-				call:         call,
-				receiverObj:  obj,
-				templateName: templateName,
-				dataType:     dataType,
-			})
-			receiverSet[obj] = struct{}{}
+			add(call, r, call.Args[1], call.Args[2])
 			return true
 		})
 	}
 
-	return pending, receiverSet
+	return pending, receiverSet, unresolved
 }
 
-// resolveTemplates resolves each unique receiver object to its template
-// construction chain, including additional ParseFS/Parse modifications.
-func resolveTemplates(pkg *packages.Package, receivers map[types.Object]struct{}) (map[types.Object]*resolvedTemplate, []error) {
-	resolved := make(map[types.Object]*resolvedTemplate)
+// receiverOf returns the receiver x names: a variable, or an element of a
+// map variable indexed with a string literal.
+func receiverOf(info *types.Info, x ast.Expr) (receiver, bool) {
+	var r receiver
+	if index, ok := x.(*ast.IndexExpr); ok {
+		key, ok := asteval.BasicLiteralString(index.Index)
+		if !ok {
+			return receiver{}, false
+		}
+		x, r.key = index.X, strconv.Quote(key)
+	}
+	ident, ok := x.(*ast.Ident)
+	if !ok {
+		return receiver{}, false
+	}
+	r.obj = info.Uses[ident]
+	return r, r.obj != nil
+}
 
-	workingDirectory := packageDirectory(pkg)
-	embeddedPaths, err := asteval.RelativeFilePaths(workingDirectory, pkg.EmbedFiles...)
+// matchRenderer returns the renderer call calls, along with the template
+// variable it executes.
+func matchRenderer(pkg *packages.Package, renderers []Renderer, call *ast.CallExpr) (Renderer, types.Object, bool) {
+	if len(renderers) == 0 || pkg.Types == nil {
+		return Renderer{}, nil, false
+	}
+	var ident *ast.Ident
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		ident = fun
+	case *ast.SelectorExpr:
+		ident = fun.Sel
+	default:
+		return Renderer{}, nil, false
+	}
+	fn, ok := pkg.TypesInfo.Uses[ident].(*types.Func)
+	if !ok {
+		return Renderer{}, nil, false
+	}
+	for _, r := range renderers {
+		if r.Func != fn.FullName() || max(r.NameArg, r.DataArg) >= len(call.Args) || min(r.NameArg, r.DataArg) < 0 {
+			continue
+		}
+		if obj, ok := pkg.Types.Scope().Lookup(r.Templates).(*types.Var); ok {
+			return r, obj, true
+		}
+	}
+	return Renderer{}, nil, false
+}
+
+// embeddedFiles describes the files pkg embeds, read from TemplateFS or
+// disk, and those of the packages it imports, read from disk.
+func (config PackageConfig) embeddedFiles(pkg *packages.Package) (*asteval.EmbeddedFiles, error) {
+	fsys := config.TemplateFS
+	if fsys == nil {
+		fsys = asteval.OverlayFS(packageDirectory(pkg), config.Overlay)
+	}
+	files, err := packageEmbeddedFiles(pkg, fsys)
 	if err != nil {
-		return nil, []error{fmt.Errorf("failed to calculate relative path for embedded files: %w", err)}
+		return nil, err
 	}
+	if config.TemplateFS != nil {
+		// go/packages joins the patterns to the package directory.
+		patterns, err := asteval.RelativeFilePaths(files.Dir, pkg.EmbedPatterns...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate relative path for embed patterns: %w", err)
+		}
+		for i, pattern := range patterns {
+			patterns[i] = filepath.ToSlash(pattern)
+		}
+		if files.Paths, err = asteval.EmbeddedPaths(config.TemplateFS, patterns); err != nil {
+			return nil, fmt.Errorf("failed to match embed patterns in TemplateFS: %w", err)
+		}
+	}
+	files.Import = func(path string) (*asteval.EmbeddedFiles, error) {
+		imported := findImport(pkg, path, make(map[*packages.Package]bool))
+		if imported == nil || imported.TypesInfo == nil {
+			return nil, fmt.Errorf("package %s is not loaded", path)
+		}
+		importedFiles, err := packageEmbeddedFiles(imported, asteval.OverlayFS(packageDirectory(imported), config.Overlay))
+		if err != nil {
+			return nil, err
+		}
+		importedFiles.Import = files.Import
+		return importedFiles, nil
+	}
+	return files, nil
+}
+
+func packageEmbeddedFiles(pkg *packages.Package, fsys fs.FS) (*asteval.EmbeddedFiles, error) {
+	dir := packageDirectory(pkg)
+	paths, err := asteval.RelativeFilePaths(dir, pkg.EmbedFiles...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate relative path for embedded files: %w", err)
+	}
+	return &asteval.EmbeddedFiles{
+		Dir:       dir,
+		Syntax:    pkg.Syntax,
+		TypesInfo: pkg.TypesInfo,
+		Paths:     paths,
+		FS:        fsys,
+	}, nil
+}
+
+// resolveTemplates resolves each unique receiver to its template
+// construction chain, including additional ParseFS/Parse modifications.
+// Variables other expressions use as receivers, such as base in
+// base.Clone(), are resolved as they are needed, with the modifications
+// that run before that use applied. It also returns the receivers nothing
+// in the package sets or that are set more than once.
+func resolveTemplates(pkg *packages.Package, receivers map[receiver]struct{}, providers asteval.FuncMapProviders, embeds *asteval.EmbeddedFiles) (map[receiver]*resolvedTemplate, map[receiver]bool, []error) {
+	resolved := make(map[receiver]*resolvedTemplate)
+
+	workingDirectory := packageDirectory(pkg)
 
 	var resolveErrs []error
 
-	resolveExpr := func(obj types.Object, name string, expr ast.Expr) {
-		if _, needed := receivers[obj]; !needed {
+	// Collect the expressions variables and map elements are set to.
+	type declaration struct {
+		name string
+		expr ast.Expr
+	}
+	var order []receiver
+	declarations := make(map[receiver]declaration)
+	// Receivers set more than once are left unresolved rather than
+	// resolved from one of the values they may hold.
+	ambiguous := make(map[receiver]bool)
+	declare := func(r receiver, name string, expr ast.Expr) {
+		if _, ok := declarations[r]; ok {
+			ambiguous[r] = true
 			return
 		}
-		funcTypeMap := asteval.DefaultFunctions(pkg.Types)
-		meta := &asteval.TemplateMetadata{}
-		ts, _, _, err := asteval.EvaluateTemplateSelector(nil, pkg.Types, pkg.TypesInfo, expr, workingDirectory, name, "", "", pkg.Fset, pkg.Syntax, embeddedPaths, funcTypeMap, make(map[string]any), meta)
-		if err != nil {
-			resolveErrs = append(resolveErrs, err)
+		order = append(order, r)
+		declarations[r] = declaration{name: name, expr: expr}
+	}
+	declareVar := func(ident *ast.Ident, expr ast.Expr) {
+		obj := pkg.TypesInfo.Defs[ident]
+		if obj == nil {
 			return
 		}
-		resolved[obj] = &resolvedTemplate{
-			templates: ts,
-			functions: funcTypeMap,
-			metadata:  meta,
+		declare(receiver{obj: obj}, ident.Name, expr)
+		// Elements of a map composite literal, such as
+		// map[string]*template.Template{"index": ...}.
+		lit, ok := expr.(*ast.CompositeLit)
+		if !ok {
+			return
+		}
+		if _, ok := pkg.TypesInfo.TypeOf(lit).Underlying().(*types.Map); !ok {
+			return
+		}
+		for _, elt := range lit.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			if key, ok := asteval.BasicLiteralString(kv.Key); ok {
+				declare(receiver{obj: obj, key: strconv.Quote(key)}, ident.Name, kv.Value)
+			}
 		}
 	}
 
-	// Resolve top-level var declarations.
+	// Top-level var declarations.
 	for _, tv := range astgen.IterateValueSpecs(pkg.Syntax) {
 		for i, ident := range tv.Names {
-			if i >= len(tv.Values) {
-				continue
-			}
-			obj := pkg.TypesInfo.Defs[ident]
-			if obj == nil {
-				continue
+			if i < len(tv.Values) {
+				declareVar(ident, tv.Values[i])
 			}
-			resolveExpr(obj, ident.Name, tv.Values[i])
 		}
 	}
 
-	// Resolve function-local var declarations and short variable declarations.
+	// Function-local var declarations, short variable declarations, and
+	// assignments to variables and map elements.
 	for _, file := range pkg.Syntax {
 		ast.Inspect(file, func(node ast.Node) bool {
 			switch n := node.(type) {
@@ -151,40 +464,48 @@ func resolveTemplates(pkg *packages.Package, receivers map[types.Object]struct{}
 						continue
 					}
 					for i, ident := range vs.Names {
-						if i >= len(vs.Values) {
-							continue
+						if i < len(vs.Values) {
+							declareVar(ident, vs.Values[i])
 						}
-						obj := pkg.TypesInfo.Defs[ident]
-						if obj == nil {
-							continue
-						}
-						resolveExpr(obj, ident.Name, vs.Values[i])
 					}
 				}
 			case *ast.AssignStmt:
-				if n.Tok != token.DEFINE {
-					return true
-				}
 				for i, lhs := range n.Lhs {
 					if i >= len(n.Rhs) {
 						continue
 					}
-					ident, ok := lhs.(*ast.Ident)
-					if !ok {
-						continue
-					}
-					obj := pkg.TypesInfo.Defs[ident]
-					if obj == nil {
-						continue
+					switch lhs := lhs.(type) {
+					case *ast.Ident:
+						switch n.Tok {
+						case token.DEFINE:
+							declareVar(lhs, n.Rhs[i])
+						case token.ASSIGN:
+							// A variable declared without a value and
+							// set later, such as in init. Assigning it a
+							// Parse or ParseFS call on itself modifies it.
+							obj, ok := pkg.TypesInfo.Uses[lhs].(*types.Var)
+							if !ok {
+								break
+							}
+							if call, ok := n.Rhs[i].(*ast.CallExpr); ok && asteval.FindModificationReceiver(call, pkg.TypesInfo) == obj {
+								break
+							}
+							declare(receiver{obj: obj}, lhs.Name, n.Rhs[i])
+						}
+					case *ast.IndexExpr:
+						if r, ok := receiverOf(pkg.TypesInfo, lhs); ok && n.Tok == token.ASSIGN && r.key != "" {
+							declare(r, r.obj.Name(), n.Rhs[i])
+						}
 					}
-					resolveExpr(obj, ident.Name, n.Rhs[i])
 				}
 			}
 			return true
 		})
 	}
 
-	// Find additional ParseFS/Parse calls on resolved template variables.
+	// Collect the additional ParseFS/Parse calls on template variables,
+	// in source order.
+	modifications := make(map[types.Object][]*ast.CallExpr)
 	for _, file := range pkg.Syntax {
 		ast.Inspect(file, func(node ast.Node) bool {
 			call, ok := node.(*ast.CallExpr)
@@ -195,28 +516,161 @@ func resolveTemplates(pkg *packages.Package, receivers map[types.Object]struct{}
 			if obj == nil {
 				return true
 			}
-			rt, ok := resolved[obj]
-			if !ok {
-				return true
+			modifications[obj] = append(modifications[obj], call)
+			// The call inside a template.Must wrapper is applied with it.
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			return !ok || sel.Sel.Name != "Must"
+		})
+	}
+
+	// A variable is resolved with the modifications that have run where it
+	// is used: all of them for the receivers of the calls checked, and
+	// those that run before it is cloned or otherwise used in another
+	// variable's construction.
+	type use struct {
+		r  receiver
+		at token.Pos
+	}
+	var (
+		resolve   func(r receiver, at token.Pos) (*resolvedTemplate, error)
+		evaluated = make(map[use]*resolvedTemplate)
+		resolving = make(map[receiver]bool)
+		failed    = make(map[receiver]error)
+	)
+	// variablesAt resolves the variables used at at, adding their
+	// function types to functions, as a Clone keeps their functions.
+	variablesAt := func(at token.Pos, functions asteval.TemplateFunctions) asteval.TemplateVariables {
+		return func(obj types.Object) (asteval.Template, *asteval.TemplateMetadata, error) {
+			rt, err := resolve(receiver{obj: obj}, at)
+			if rt == nil {
+				return nil, nil, err
 			}
-			meta := &asteval.TemplateMetadata{}
-			ts, _, _, err := asteval.EvaluateTemplateSelector(rt.templates, pkg.Types, pkg.TypesInfo, call, workingDirectory, "", "", "", pkg.Fset, pkg.Syntax, embeddedPaths, rt.functions, make(map[string]any), meta)
+			maps.Copy(functions, rt.functions)
+			return rt.templates, rt.metadata, nil
+		}
+	}
+	resolve = func(r receiver, at token.Pos) (*resolvedTemplate, error) {
+		if rt, ok := evaluated[use{r, at}]; ok {
+			return rt, nil
+		}
+		if err, ok := failed[r]; ok {
+			return nil, err
+		}
+		decl, ok := declarations[r]
+		if !ok || ambiguous[r] || resolving[r] {
+			return nil, nil
+		}
+		resolving[r] = true
+		defer delete(resolving, r)
+		funcTypeMap := asteval.DefaultFunctions(pkg.Types)
+		funcs := make(map[string]any)
+		meta := &asteval.TemplateMetadata{}
+		ts, _, _, err := asteval.EvaluateTemplateSelector(nil, pkg.Types, pkg.TypesInfo, decl.expr, workingDirectory, decl.name, "", "", pkg.Fset, embeds, funcTypeMap, providers, variablesAt(decl.expr.Pos(), funcTypeMap), funcs, meta)
+		if err != nil {
+			failed[r] = err
+			return nil, err
+		}
+		rt := &resolvedTemplate{
+			templates: ts,
+			functions: funcTypeMap,
+			metadata:  meta,
+			funcs:     funcs,
+		}
+		evaluated[use{r, at}] = rt
+		if r.key != "" {
+			return rt, nil
+		}
+		for _, call := range modifications[r.obj] {
+			if at.IsValid() && !runsBefore(pkg.Syntax, call.Pos(), at) {
+				continue
+			}
+			meta := &asteval.TemplateMetadata{Overridable: rt.metadata.Overridable}
+			ts, _, _, err := asteval.EvaluateTemplateSelector(rt.templates, pkg.Types, pkg.TypesInfo, call, workingDirectory, "", "", "", pkg.Fset, embeds, rt.functions, providers, variablesAt(call.Pos(), rt.functions), rt.funcs, meta)
 			if err != nil {
-				return true
+				continue
 			}
 			rt.templates = ts
-			rt.metadata.EmbedFilePaths = append(rt.metadata.EmbedFilePaths, meta.EmbedFilePaths...)
-			rt.metadata.ParseCalls = append(rt.metadata.ParseCalls, meta.ParseCalls...)
-			return true
-		})
+			rt.metadata.Merge(meta)
+		}
+		return rt, nil
+	}
+
+	for _, r := range order {
+		if _, needed := receivers[r]; !needed {
+			continue
+		}
+		// An error resolving a variable another receiver uses is
+		// reported once.
+		rt, err := resolve(r, token.NoPos)
+		if err != nil && !slices.Contains(resolveErrs, err) {
+			resolveErrs = append(resolveErrs, err)
+		}
+		if rt != nil {
+			resolved[r] = rt
+		}
+	}
+
+	// Receivers nothing sets, such as function parameters, are left
+	// unresolved, as are those set more than once.
+	unresolved := make(map[receiver]bool)
+	for r := range receivers {
+		if _, ok := declarations[r]; !ok || ambiguous[r] {
+			unresolved[r] = true
+		}
+	}
+
+	return resolved, unresolved, resolveErrs
+}
+
+// runsBefore reports whether the code at pos in files has run by the time
+// the code at at runs. Package-level variables are initialized before init
+// functions run, and those run, in order, before other functions are
+// called; code in two functions other than init is taken to run in no
+// known order.
+func runsBefore(files []*ast.File, pos, at token.Pos) bool {
+	fn, atFn := enclosingFunc(files, pos), enclosingFunc(files, at)
+	switch {
+	case fn == nil:
+		return atFn != nil || pos < at
+	case isInit(fn):
+		return atFn != nil && (!isInit(atFn) || pos < at)
+	default:
+		return fn == atFn && pos < at
 	}
+}
 
-	return resolved, resolveErrs
+// enclosingFunc returns the function declaration in files containing pos,
+// or nil for a position in a package-level declaration.
+func enclosingFunc(files []*ast.File, pos token.Pos) *ast.FuncDecl {
+	for _, file := range files {
+		if pos < file.Pos() || pos >= file.End() {
+			continue
+		}
+		for _, decl := range file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Pos() <= pos && pos < fn.End() {
+				return fn
+			}
+		}
+	}
+	return nil
+}
+
+// isInit reports whether fn is a package initialization function.
+func isInit(fn *ast.FuncDecl) bool {
+	return fn.Recv == nil && fn.Name.Name == "init"
+}
+
+// checkedCall records the trees checking an ExecuteTemplate call walked and
+// the Go check:ignore directive for the call, if any.
+type checkedCall struct {
+	receiver  receiver
+	walked    []*parse.Tree
+	directive *suppression
 }
 
 // checkCalls type-checks each pending ExecuteTemplate call against its
-// resolved template.
-func checkCalls(pkg *packages.Package, pending []pendingCall, resolved map[types.Object]*resolvedTemplate, inspectCall ExecuteTemplateNodeInspectorFunc, inspectTemplate TemplateNodeInspectorFunc) error {
+// resolved template, and reports the redefinitions found resolving them.
+func (config PackageConfig) checkCalls(pkg *packages.Package, pending []pendingCall, resolved map[receiver]*resolvedTemplate) error {
 	mergedFunctions := make(Functions)
 	if pkg.Types != nil {
 		mergedFunctions = DefaultFunctions(pkg.Types)
@@ -227,9 +681,24 @@ func checkCalls(pkg *packages.Package, pending []pendingCall, resolved map[types
 		}
 	}
 
-	var errs []error
+	var (
+		errs     []error
+		literals = make(map[*parse.Tree]*ast.BasicLit)
+		sources  = make(map[*parse.Tree]string)
+		// Template directives are collected once per tree, the first time
+		// a call walks it, so their use is tracked across calls.
+		treeSuppressions = make(map[*parse.Tree][]*suppression)
+		walkedTrees      []*parse.Tree
+		goDirectives     = goSuppressions(pkg.Fset, pkg.Syntax)
+		callDirectives   []*suppression
+		checked          []checkedCall
+	)
+	var docs *docComments
+	if config.Deprecations {
+		docs = packageDocComments(pkg)
+	}
 	for _, p := range pending {
-		rt, ok := resolved[p.receiverObj]
+		rt, ok := resolved[p.receiver]
 		if !ok {
 			continue
 		}
@@ -237,16 +706,98 @@ func checkCalls(pkg *packages.Package, pending []pendingCall, resolved map[types
 		if looked == nil {
 			continue
 		}
+		maps.Copy(literals, rt.metadata.ParseTrees)
+		maps.Copy(sources, rt.metadata.Sources)
+		walked := []*parse.Tree{looked.Tree()}
 		global := NewGlobal(pkg.Types, pkg.Fset, rt.templates, mergedFunctions)
-		global.InspectTemplateNode = inspectTemplate
-		if inspectCall != nil {
-			inspectCall(p.call, looked.Tree(), p.dataType)
+		global.InspectTemplateNode = func(node *parse.TemplateNode, t *parse.Tree, tp types.Type) {
+			if invoked := rt.templates.Lookup(node.Name); invoked != nil && invoked.Tree() != nil {
+				walked = append(walked, invoked.Tree())
+			}
+			if config.InspectTemplate != nil {
+				config.InspectTemplate(node, t, tp)
+			}
+		}
+		global.Lenient = config.Lenient
+		global.InspectUncheckedNode = config.InspectUnchecked
+		global.NilPointers = config.NilPointers
+		global.Deprecations = config.Deprecations
+		global.docs = docs
+		global.Sources = rt.metadata.Sources
+		if config.Sources != nil {
+			maps.Copy(config.Sources, rt.metadata.Sources)
 		}
-		if err := Execute(global, looked.Tree(), p.dataType); err != nil {
+		global.Overlay = config.Overlay
+		if config.InspectCall != nil {
+			config.InspectCall(p.call, looked.Tree(), p.dataType)
+		}
+		err := Execute(global, looked.Tree(), p.dataType)
+
+		var sups []*suppression
+		for _, tree := range walked {
+			if _, ok := treeSuppressions[tree]; !ok {
+				treeSuppressions[tree] = templateSuppressions(tree)
+				walkedTrees = append(walkedTrees, tree)
+			}
+			sups = append(sups, treeSuppressions[tree]...)
+		}
+		directive := callSuppression(pkg.Fset, goDirectives, p.call)
+		if directive != nil {
+			sups = append(sups, directive)
+			if !slices.Contains(callDirectives, directive) {
+				callDirectives = append(callDirectives, directive)
+			}
+		}
+		checked = append(checked, checkedCall{receiver: p.receiver, walked: walked, directive: directive})
+		if checkErr, ok := err.(*Error); ok && len(sups) > 0 {
+			if kept := suppress(checkErr, sups); kept != nil {
+				err = kept
+			} else {
+				err = nil
+			}
+		}
+		if err != nil {
+			locateInLiterals(err, pkg.Fset, rt.metadata.ParseTrees)
 			errs = append(errs, err)
 		}
 	}
 
+	// A redefinition is suppressed the way the failures found checking a
+	// call are: by directives in the redefining tree, and by the Go
+	// directives of the calls that walk it.
+	redefined := redefinitionErrors(pkg, resolved, func(r receiver, tree *parse.Tree) []*suppression {
+		sups, ok := treeSuppressions[tree]
+		if !ok {
+			sups = templateSuppressions(tree)
+		}
+		for _, c := range checked {
+			if c.receiver == r && c.directive != nil && slices.Contains(c.walked, tree) {
+				sups = append(slices.Clip(sups), c.directive)
+			}
+		}
+		return sups
+	})
+	errs = append(redefined, errs...)
+
+	var unused []error
+	for _, tree := range walkedTrees {
+		for _, s := range treeSuppressions[tree] {
+			for _, e := range s.unused(sources) {
+				unused = append(unused, e)
+			}
+		}
+	}
+	for _, s := range callDirectives {
+		for _, e := range s.unused(sources) {
+			unused = append(unused, e)
+		}
+	}
+	if len(unused) > 0 {
+		unusedErr := joinErrors(nil, nil, unused...)
+		locateInLiterals(unusedErr, pkg.Fset, literals)
+		errs = append(errs, unusedErr)
+	}
+
 	return joinErrors(nil, nil, errs...)
 }
 
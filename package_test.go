@@ -0,0 +1,70 @@
+package check_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+
+	"github.com/typelate/check"
+)
+
+func TestPackageConfig_TemplateFS(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.25.0\n",
+		"main.go": `package main
+
+import (
+	"embed"
+	"html/template"
+	"io"
+)
+
+//go:embed templates
+var source embed.FS
+
+var templates = template.Must(template.ParseFS(source, "templates/*.gohtml"))
+
+type Page struct {
+	Title string
+}
+
+func render(w io.Writer) error {
+	return templates.ExecuteTemplate(w, "index.gohtml", Page{})
+}
+`,
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	pkgs, err := packages.Load(&packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedSyntax |
+			packages.NeedTypes | packages.NeedTypesInfo | packages.NeedDeps |
+			packages.NeedImports | packages.NeedEmbedPatterns | packages.NeedEmbedFiles,
+		Dir: dir,
+	}, ".")
+	require.NoError(t, err)
+	require.Len(t, pkgs, 1)
+	require.Empty(t, pkgs[0].EmbedFiles, "the templates must exist only in TemplateFS")
+
+	t.Run("embedded files come from TemplateFS", func(t *testing.T) {
+		config := check.PackageConfig{TemplateFS: fstest.MapFS{
+			"templates/index.gohtml":        {Data: []byte(`<h1>{{.Title}}</h1>{{template "nav.gohtml" .}}`)},
+			"templates/nav.gohtml":          {Data: []byte(`<nav>{{.Missing}}</nav>`)},
+			"templates/_draft/index.gohtml": {Data: []byte(`{{.Draft}}`)},
+		}}
+		err := config.Check(pkgs[0])
+		require.ErrorContains(t, err, `executing "nav.gohtml" at <.Missing>: field or method Missing not found`)
+		require.NotContains(t, err.Error(), "Draft")
+	})
+
+	t.Run("files outside the embed patterns", func(t *testing.T) {
+		config := check.PackageConfig{TemplateFS: fstest.MapFS{
+			"index.gohtml": {Data: []byte(`{{.Title}}`)},
+		}}
+		require.ErrorContains(t, config.Check(pkgs[0]), "no files named in call to ParseFiles")
+	})
+}
@@ -0,0 +1,149 @@
+package check
+
+import (
+	"go/token"
+	"reflect"
+	"strings"
+	"text/template/parse"
+)
+
+// span is a range of byte offsets in a template's source. The zero value
+// means unknown: a known span is never empty.
+type span struct {
+	pos, end int
+}
+
+// withSpan narrows the error's range to s and returns e.
+func (e *Error) withSpan(s span) *Error {
+	e.span = s
+	return e
+}
+
+// NodeRange returns where n starts and ends in the source tree was parsed
+// from; end is exclusive. sources maps trees to that text, as
+// Global.Sources does: for a tree it has no entry for, the positions have
+// an offset but no line or column. Columns count bytes from 1 as in
+// go/token, while ErrorContext, and so the location in an Error message,
+// counts them from 0 the way text/template reports runtime errors.
+func NodeRange(sources map[*parse.Tree]string, tree *parse.Tree, n parse.Node) (start, end token.Position) {
+	if tree == nil || isNilNode(n) {
+		return token.Position{}, token.Position{}
+	}
+	s := nodeSpan(n)
+	return treePosition(sources, tree, s.pos), treePosition(sources, tree, s.end)
+}
+
+// locate sets Start and End from the error's span, or from its node when
+// no narrower span is known. sources maps trees to the text they were
+// parsed from, as Global.Sources does.
+func (e *Error) locate(sources map[*parse.Tree]string) {
+	if e.Tree == nil || isNilNode(e.Node) || e.Start.IsValid() {
+		return
+	}
+	s := e.span
+	if s.end == 0 {
+		s = nodeSpan(e.Node)
+	}
+	e.Start, e.End = treePosition(sources, e.Tree, s.pos), treePosition(sources, e.Tree, s.end)
+}
+
+// isNilNode reports whether n is nil or holds a nil pointer, such as the
+// Pipe of a {{template}} action without one.
+func isNilNode(n parse.Node) bool {
+	if n == nil {
+		return true
+	}
+	v := reflect.ValueOf(n)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
+
+// treePosition converts offset, a byte offset in the text tree was parsed
+// from, to a position in that file. The position has no line or column
+// when sources has no entry for tree or offset is outside its text.
+func treePosition(sources map[*parse.Tree]string, tree *parse.Tree, offset int) token.Position {
+	pos := token.Position{Filename: tree.ParseName, Offset: offset}
+	src, ok := sources[tree]
+	if !ok || offset < 0 || offset > len(src) {
+		return pos
+	}
+	before := src[:offset]
+	pos.Line = 1 + strings.Count(before, "\n")
+	pos.Column = offset - strings.LastIndexByte(before, '\n')
+	return pos
+}
+
+// identSpan returns the span of the i-th selected identifier of n.
+func identSpan(n parse.Node, i int, ident string) span {
+	offsets := selectorOffsets(n)
+	if i >= len(offsets) {
+		return span{}
+	}
+	return span{offsets[i], offsets[i] + len(ident)}
+}
+
+// nodeSpan returns the source span of n. Node positions are where
+// text/template's parser saw the node's first token, so the span of an
+// action or control structure covers its pipeline, not its delimiters.
+func nodeSpan(n parse.Node) span {
+	pos := int(n.Position())
+	switch n := n.(type) {
+	case *parse.FieldNode, *parse.VariableNode:
+		start := nodeStart(n)
+		return span{start, start + len(n.String())}
+	case *parse.ChainNode:
+		end := pos
+		for _, field := range n.Field {
+			end += len(field) + 1
+		}
+		return span{nodeSpan(n.Node).pos, end}
+	case *parse.IdentifierNode:
+		return span{pos, pos + len(n.Ident)}
+	case *parse.StringNode:
+		return span{pos, pos + len(n.Quoted)}
+	case *parse.NumberNode:
+		return span{pos, pos + len(n.Text)}
+	case *parse.BoolNode, *parse.NilNode, *parse.DotNode:
+		return span{pos, pos + len(n.String())}
+	case *parse.BreakNode:
+		return span{pos, pos + len("break")}
+	case *parse.ContinueNode:
+		return span{pos, pos + len("continue")}
+	case *parse.TextNode:
+		return span{pos, pos + len(n.Text)}
+	case *parse.CommentNode:
+		return span{pos, pos + len(n.Text)}
+	case *parse.CommandNode:
+		if len(n.Args) > 0 {
+			return span{nodeSpan(n.Args[0]).pos, nodeSpan(n.Args[len(n.Args)-1]).end}
+		}
+	case *parse.PipeNode:
+		if n == nil || len(n.Cmds) == 0 {
+			break
+		}
+		s := span{nodeSpan(n.Cmds[0]).pos, nodeSpan(n.Cmds[len(n.Cmds)-1]).end}
+		if len(n.Decl) > 0 {
+			s.pos = nodeSpan(n.Decl[0]).pos
+		}
+		return s
+	case *parse.ActionNode:
+		return nodeSpan(n.Pipe)
+	case *parse.IfNode:
+		return nodeSpan(n.Pipe)
+	case *parse.RangeNode:
+		return nodeSpan(n.Pipe)
+	case *parse.WithNode:
+		return nodeSpan(n.Pipe)
+	case *parse.TemplateNode:
+		if n.Pipe != nil {
+			return span{pos, nodeSpan(n.Pipe).end}
+		}
+		// The name may be a raw string; without escapes both quotings
+		// have the same length.
+		return span{pos, pos + len(n.Name) + 2}
+	case *parse.ListNode:
+		if n != nil && len(n.Nodes) > 0 {
+			return span{nodeSpan(n.Nodes[0]).pos, nodeSpan(n.Nodes[len(n.Nodes)-1]).end}
+		}
+	}
+	return span{pos, pos}
+}
@@ -0,0 +1,106 @@
+package check
+
+import (
+	"cmp"
+	"go/types"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// maxSuggestions caps how many names an Error suggests.
+const maxSuggestions = 3
+
+// builtinFunctionNames lists text/template's predefined global functions.
+var builtinFunctionNames = []string{
+	"and", "call", "eq", "ge", "gt", "html", "index", "js", "le", "len", "lt",
+	"ne", "not", "or", "print", "printf", "println", "slice", "urlquery",
+}
+
+// TreeLister is implemented by a TreeFinder that can enumerate the
+// templates it finds. Execute uses it to suggest template names when
+// {{template}} names one that does not exist.
+type TreeLister interface {
+	TreeNames() []string
+}
+
+// suggest returns the candidates name was most likely meant to be: those
+// equal to it ignoring case or, failing that, those within an edit distance
+// of about a third of its length. Closer names come first.
+func suggest(name string, candidates []string) []string {
+	type scored struct {
+		name     string
+		distance int
+	}
+	lower := strings.ToLower(name)
+	limit := max(1, len(name)/3)
+	var matches []scored
+	for _, candidate := range candidates {
+		if candidate == name || slices.ContainsFunc(matches, func(m scored) bool { return m.name == candidate }) {
+			continue
+		}
+		if strings.EqualFold(candidate, name) {
+			matches = append(matches, scored{candidate, 0})
+			continue
+		}
+		if d := editDistance(lower, strings.ToLower(candidate)); d <= limit {
+			matches = append(matches, scored{candidate, d})
+		}
+	}
+	slices.SortFunc(matches, func(a, b scored) int {
+		return cmp.Or(cmp.Compare(a.distance, b.distance), strings.Compare(a.name, b.name))
+	})
+	var names []string
+	for _, m := range matches[:min(len(matches), maxSuggestions)] {
+		names = append(names, m.name)
+	}
+	return names
+}
+
+// editDistance is the optimal string alignment distance between a and b:
+// the number of byte insertions, deletions, substitutions, and adjacent
+// transpositions turning one into the other.
+func editDistance(a, b string) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	row := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			row[j] = min(prev[j]+1, row[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				row[j] = min(row[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, row = prev, row, prev2
+	}
+	return prev[len(b)]
+}
+
+// memberNames lists the exported fields and methods selectable on tp.
+func memberNames(tp types.Type) []string {
+	fields, methods, _ := typeMembers(tp, fullTypeFormat(nil))
+	names := make([]string, 0, len(fields)+len(methods))
+	for _, m := range slices.Concat(fields, methods) {
+		names = append(names, m.name)
+	}
+	return names
+}
+
+// functionNames lists the functions a call may name: those in functions
+// and the built-ins.
+func functionNames(functions Functions) []string {
+	return slices.AppendSeq(slices.Clone(builtinFunctionNames), maps.Keys(functions))
+}
+
+// formatSuggestions renders suggestions as "did you mean A, B?".
+func formatSuggestions(suggestions []string) string {
+	return "did you mean " + strings.Join(suggestions, ", ") + "?"
+}
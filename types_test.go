@@ -544,3 +544,30 @@ func die() bool { panic("die") }
 type Fooer interface {
 	Foo() string
 }
+
+type UserID string
+
+type MapWithMethod map[string]string
+
+func (MapWithMethod) Get() string { return "" }
+
+type Count int
+
+type Names []string
+
+func (names Names) Len() int { return len(names) }
+
+type Int8Seq iter.Seq[int8]
+
+func (Iterators) Named() Int8Seq {
+	return Int8Seq(Iterators{}.Method())
+}
+
+func closedChan(values ...string) chan string {
+	ch := make(chan string, len(values))
+	for _, v := range values {
+		ch <- v
+	}
+	close(ch)
+	return ch
+}